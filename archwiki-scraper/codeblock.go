@@ -0,0 +1,224 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	filePathPattern = regexp.MustCompile(`^(~|\$[A-Za-z_]+|\.)?/\S+$`)
+	iniSectionLine  = regexp.MustCompile(`^\[[^\]]+\]$`)
+	keyValueLine    = regexp.MustCompile(`^[A-Za-z_][\w.-]*\s*=`)
+	rootPromptLine  = regexp.MustCompile(`^# (pacman|systemctl|mount|umount|mkfs(\.\w+)?|pacstrap|arch-chroot|ip|modprobe|journalctl|useradd|usermod|passwd|ln|cp|mv|rm|mkdir|chmod|chown|fdisk|gdisk|parted|cryptsetup|grub-\w+|bootctl|mkinitcpio|echo|cat|swapon|timedatectl|hwclock|locale-gen|genfstab)\b`)
+
+	languageClassPrefixes = []string{"mw-highlight-lang-", "lang-", "language-"}
+	legacyLanguageClasses = []string{"bash", "shell", "python"}
+)
+
+var languageByExtension = map[string]string{
+	".ini":       "ini",
+	".desktop":   "ini",
+	".service":   "ini",
+	".socket":    "ini",
+	".timer":     "ini",
+	".mount":     "ini",
+	".automount": "ini",
+	".target":    "ini",
+	".path":      "ini",
+	".network":   "ini",
+	".netdev":    "ini",
+	".link":      "ini",
+	".toml":      "toml",
+	".yaml":      "yaml",
+	".yml":       "yaml",
+	".json":      "json",
+	".xml":       "xml",
+	".sh":        "bash",
+	".bash":      "bash",
+	".zsh":       "zsh",
+	".fish":      "fish",
+	".install":   "bash",
+	".hook":      "ini",
+	".py":        "python",
+	".lua":       "lua",
+	".js":        "javascript",
+	".css":       "css",
+	".vim":       "vim",
+	".el":        "elisp",
+	".rules":     "udev",
+}
+
+var languageByBasename = map[string]string{
+	"PKGBUILD":        "bash",
+	".bashrc":         "bash",
+	".bash_profile":   "bash",
+	".profile":        "bash",
+	".zshrc":          "zsh",
+	".zprofile":       "zsh",
+	".xinitrc":        "bash",
+	".vimrc":          "vim",
+	"vimrc":           "vim",
+	"Makefile":        "makefile",
+	"nginx.conf":      "nginx",
+	"xorg.conf":       "xorg",
+	"pacman.conf":     "ini",
+	"makepkg.conf":    "bash",
+	"mkinitcpio.conf": "bash",
+}
+
+func parseCodeBlock(s *goquery.Selection) Block {
+	pre := s
+	if s.Is("div.mw-highlight") {
+		pre = s.ChildrenFiltered("pre").First()
+	}
+	if !pre.Is("pre") {
+		return nil
+	}
+
+	head, code := splitCodeHead(pre)
+	code = strings.Trim(code, "\n")
+	if strings.TrimSpace(code) == "" && head == "" {
+		return nil
+	}
+
+	caption := ""
+	if filePathPattern.MatchString(head) {
+		caption = head
+	} else if head != "" {
+		code = strings.TrimSpace(head + "\n" + code)
+	}
+	if caption == "" {
+		caption = precedingCodeCaption(s)
+	}
+
+	return CodeBlock{
+		Language: detectLanguage(s, pre, caption, code),
+		Caption:  caption,
+		Code:     code,
+	}
+}
+
+func splitCodeHead(pre *goquery.Selection) (string, string) {
+	var head string
+	var code strings.Builder
+	seenContent := false
+	pre.Contents().Each(func(_ int, s *goquery.Selection) {
+		if !seenContent && goquery.NodeName(s) == "#text" && strings.TrimSpace(s.Text()) == "" {
+			return
+		}
+		if !seenContent && s.Is("b") {
+			head = strings.TrimSpace(s.Text())
+			seenContent = true
+			return
+		}
+		seenContent = true
+		code.WriteString(s.Text())
+	})
+	return head, code.String()
+}
+
+func detectLanguage(container, pre *goquery.Selection, caption, code string) string {
+	if lang := languageFromClasses(pre, container); lang != "" {
+		return lang
+	}
+	if caption != "" {
+		if lang := languageFromPath(caption); lang != "" {
+			return lang
+		}
+	}
+	return languageFromContent(code)
+}
+
+func languageFromClasses(sels ...*goquery.Selection) string {
+	for _, s := range sels {
+		class, _ := s.Attr("class")
+		for _, c := range strings.Fields(class) {
+			for _, prefix := range languageClassPrefixes {
+				if lang, ok := strings.CutPrefix(c, prefix); ok && lang != "" {
+					return strings.ToLower(lang)
+				}
+			}
+		}
+		for _, lang := range legacyLanguageClasses {
+			if s.HasClass(lang) {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+func languageFromPath(filePath string) string {
+	base := path.Base(filePath)
+	if lang, ok := languageByBasename[base]; ok {
+		return lang
+	}
+	return languageByExtension[strings.ToLower(path.Ext(base))]
+}
+
+func languageFromContent(code string) string {
+	lines := strings.Split(strings.TrimSpace(code), "\n")
+	first := strings.TrimSpace(lines[0])
+
+	switch {
+	case strings.HasPrefix(first, "#!") && strings.Contains(first, "python"):
+		return "python"
+	case strings.HasPrefix(first, "#!") && strings.HasSuffix(first, "sh"):
+		return "bash"
+	case strings.HasPrefix(first, "<?xml"):
+		return "xml"
+	case strings.HasPrefix(first, "$ ") || rootPromptLine.MatchString(first):
+		return "console"
+	case strings.HasPrefix(first, "{") && strings.HasSuffix(strings.TrimSpace(code), "}"):
+		return "json"
+	}
+
+	sections, pairs := 0, 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case iniSectionLine.MatchString(line):
+			sections++
+		case keyValueLine.MatchString(line):
+			pairs++
+		}
+	}
+	if sections > 0 && pairs > 0 {
+		return "ini"
+	}
+	return ""
+}
+
+func precedingCodeCaption(s *goquery.Selection) string {
+	prev := s.Prev()
+	if prev.Length() == 0 || !isCaptionElement(prev) {
+		return ""
+	}
+	return captionText(prev)
+}
+
+func isCodeCaption(s *goquery.Selection) bool {
+	if !isCaptionElement(s) {
+		return false
+	}
+	next := s.Next()
+	return next.Is("pre") || next.Is("div.mw-highlight")
+}
+
+func isCaptionElement(s *goquery.Selection) bool {
+	if s.HasClass("mw-highlight-caption") || s.HasClass("code-caption") {
+		return true
+	}
+	if !s.Is("p") {
+		return false
+	}
+	return filePathPattern.MatchString(captionText(s))
+}
+
+func captionText(s *goquery.Selection) string {
+	text := strings.TrimSpace(s.Text())
+	return strings.TrimSpace(strings.TrimSuffix(text, ":"))
+}
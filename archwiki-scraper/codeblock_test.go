@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestProcessCodeBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "legacy class",
+			html: `<pre class="bash">ls -l</pre>`,
+			want: "```bash\nls -l\n```",
+		},
+		{
+			name: "mediawiki highlight wrapper",
+			html: `<div class="mw-highlight mw-highlight-lang-python mw-content-ltr"><pre><span class="k">import</span> os</pre></div>`,
+			want: "```python\nimport os\n```",
+		},
+		{
+			name: "file path head becomes title",
+			html: `<pre><b>/etc/fstab</b>
+UUID=abc / ext4 defaults 0 1</pre>`,
+			want: "```text title=\"/etc/fstab\"\nUUID=abc / ext4 defaults 0 1\n```",
+		},
+		{
+			name: "language inferred from caption",
+			html: `<pre><b>/etc/systemd/system/foo.service</b>
+[Unit]
+Description=Foo</pre>`,
+			want: "```ini title=\"/etc/systemd/system/foo.service\"\n[Unit]\nDescription=Foo\n```",
+		},
+		{
+			name: "command head kept in block",
+			html: `<pre><b>$ lsblk</b>
+sda 8:0</pre>`,
+			want: "```console\n$ lsblk\nsda 8:0\n```",
+		},
+		{
+			name: "root prompt",
+			html: `<pre># pacman -Syu</pre>`,
+			want: "```console\n# pacman -Syu\n```",
+		},
+		{
+			name: "unknown content",
+			html: `<pre>some output</pre>`,
+			want: "```\nsome output\n```",
+		},
+		{
+			name: "fence longer than backticks in code",
+			html: "<pre>```bash\nls\n```</pre>",
+			want: "````\n```bash\nls\n```\n````",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got := renderBlock(parseCodeBlock(doc.Find("body").Children().First()))
+			if got != tt.want {
+				t.Errorf("renderBlock(parseCodeBlock()) =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertToMarkdownCodeCaption(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div id="mw-content-text"><div class="mw-parser-output">
+		<p>Add the following:</p>
+		<p><code>~/.config/foot/foot.ini</code></p>
+		<pre>[main]
+font=monospace:size=10</pre>
+	</div></div>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	got := ConvertToMarkdown(doc.Find("div#mw-content-text"))
+	want := "Add the following:\n\n```ini title=\"~/.config/foot/foot.ini\"\n[main]\nfont=monospace:size=10\n```"
+	if got != want {
+		t.Errorf("ConvertToMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/kyeb/archwiki-scraper/wikipath"
+)
+
+func runConvert(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s convert [flags] [file.html | directory | -]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flags.Output(), "Converts saved Arch Wiki HTML pages. Reads stdin when no path or - is given.")
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", "", "directory to write converted pages to (default: stdout)")
+	pageURL := flags.String("url", "", "page URL for the front matter (default: derived from the file name)")
+	title := flags.String("title", "", "page title for the front matter (default: the page heading or file name)")
+	flags.StringVar(outputFormat, "format", *outputFormat, "output format: markdown, plaintext, json or html")
+	flags.BoolVar(downloadMedia, "download-media", *downloadMedia, "download images into an assets directory shared by all pages in the output directory")
+	flags.BoolVar(tableOfContents, "toc", *tableOfContents, "insert a table of contents at the top of each markdown page")
+	flags.StringVar(skipRulesFile, "skip-rules", *skipRulesFile, "JSON file with CSS selectors to exclude from or include in converted pages")
+	flags.Parse(args)
+
+	if _, ok := outputFormats[*outputFormat]; !ok {
+		return fmt.Errorf("unknown output format %q", *outputFormat)
+	}
+	if *skipRulesFile != "" {
+		rules, err := loadSkipRules(*skipRulesFile)
+		if err != nil {
+			return err
+		}
+		activeSkipRules = rules
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one input path, got %d", flags.NArg())
+	}
+	outputDir = *output
+	if outputDir != "" {
+		outputDir = filepath.Clean(outputDir)
+	}
+
+	if err := convertInput(flags.Arg(0), stdin, stdout, *pageURL, *title); err != nil {
+		return err
+	}
+	if outputDir == "" {
+		return nil
+	}
+	return pageFiles.WriteFile(filepath.Join(outputDir, wikipath.TitlesFile), formatExtension(*outputFormat))
+}
+
+func convertInput(input string, stdin io.Reader, stdout io.Writer, pageURL, title string) error {
+	if input == "" || input == "-" {
+		return convertReader(stdout, stdin, "stdin", pageURL, title)
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return convertReader(stdout, f, strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)), pageURL, title)
+	}
+
+	if outputDir == "" {
+		return fmt.Errorf("converting a directory requires -output")
+	}
+	return filepath.WalkDir(input, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".html") {
+			return err
+		}
+		rel, err := filepath.Rel(input, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return convertReader(stdout, f, filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), "", "")
+	})
+}
+
+// convertReader converts one HTML page, writing it to w unless an output
+// directory is set. name is the page's wiki path, such as "Arch_Linux", and
+// provides the defaults for pageURL and title. The output file is named after
+// pageURL.
+func convertReader(w io.Writer, r io.Reader, name, pageURL, title string) error {
+	html, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+
+	content := html.Find("div#mw-content-text")
+	if content.Length() == 0 {
+		content = html.Selection
+	}
+	doc := ParseDocument(content)
+	if doc == nil {
+		return fmt.Errorf("no div.mw-parser-output found in %s", name)
+	}
+
+	if pageURL == "" {
+		pageURL = baseURL + "/title/" + name
+	}
+	meta := extractPageMeta(html.Selection, pageURL)
+	meta.Title = title
+	if meta.Title == "" {
+		meta.Title = strings.TrimSpace(html.Find("h1#firstHeading").Text())
+	}
+	if meta.Title == "" {
+		meta.Title = strings.ReplaceAll(filepath.Base(name), "_", " ")
+	}
+
+	filename := urlToFilename(pageURL)
+	if outputDir == "" {
+		meta.DateScraped = time.Now().Truncate(time.Second)
+		page, err := renderPage(*outputFormat, doc, filename, meta)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(page)
+		return err
+	}
+	return savePage(filename, doc, meta)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kyeb/archwiki-scraper/wikipath"
+)
+
+func TestRunConvert(t *testing.T) {
+	defer func(dir, format string) { outputDir, *outputFormat = dir, format }(outputDir, *outputFormat)
+	defer func(files *wikipath.Manifest) { pageFiles = files }(pageFiles)
+
+	t.Run("file to stdout", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := runConvert([]string{"testdata/golden/nested_lists.html"}, nil, &stdout); err != nil {
+			t.Fatalf("runConvert() error = %v", err)
+		}
+		got := stdout.String()
+		for _, want := range []string{
+			"---\ntitle: nested lists\nurl: https://wiki.archlinux.org/title/nested_lists\n",
+			"## Installation",
+			"[EFI system partition](EFI_system_partition.md)",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %q in output:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("stdin with front matter flags", func(t *testing.T) {
+		var stdout bytes.Buffer
+		stdin := strings.NewReader(`<div class="mw-parser-output"><p>See <a href="/title/Pacman">pacman</a>.</p></div>`)
+		args := []string{"-title", "Example", "-url", "https://wiki.archlinux.org/title/Example", "-format", "plaintext"}
+		if err := runConvert(args, stdin, &stdout); err != nil {
+			t.Fatalf("runConvert() error = %v", err)
+		}
+		if want := "Example\n\nSee pacman.\n"; stdout.String() != want {
+			t.Errorf("output = %q, want %q", stdout.String(), want)
+		}
+	})
+
+	t.Run("directory to output dir", func(t *testing.T) {
+		pageFiles = wikipath.NewManifest()
+		in, out := t.TempDir(), t.TempDir()
+		page := `<div class="mw-parser-output"><p>See <a href="/title/Pacman">pacman</a>.</p></div>`
+		if err := os.MkdirAll(filepath.Join(in, "Pacman"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"Pacman.html", "Pacman/Tips_and_tricks.html"} {
+			if err := os.WriteFile(filepath.Join(in, name), []byte(page), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := runConvert([]string{"-format", "markdown", "-output", out, in}, nil, &bytes.Buffer{}); err != nil {
+			t.Fatalf("runConvert() error = %v", err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(out, "Pacman~2FTips_and_tricks.md"))
+		if err != nil {
+			t.Fatalf("expected converted subpage: %v", err)
+		}
+		for _, want := range []string{"title: Tips and tricks\n", "url: https://wiki.archlinux.org/title/Pacman/Tips_and_tricks\n", "See [pacman](Pacman.md)."} {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("expected %q in output:\n%s", want, got)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(out, "Pacman.md")); err != nil {
+			t.Errorf("expected converted page: %v", err)
+		}
+		files, err := wikipath.ReadFiles(filepath.Join(out, wikipath.TitlesFile))
+		if err != nil {
+			t.Fatalf("expected title manifest: %v", err)
+		}
+		if want := map[string]string{"Pacman.md": "Pacman", "Pacman~2FTips_and_tricks.md": "Pacman/Tips and tricks"}; !reflect.DeepEqual(files, want) {
+			t.Errorf("manifest = %v, want %v", files, want)
+		}
+	})
+
+	t.Run("missing content", func(t *testing.T) {
+		if err := runConvert([]string{"-format", "markdown"}, strings.NewReader("<p>Not a wiki page</p>"), &bytes.Buffer{}); err == nil {
+			t.Error("expected error for HTML without div.mw-parser-output")
+		}
+	})
+}
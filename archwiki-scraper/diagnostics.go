@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const diagnosticsFile = "conversion_report.json"
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// PageDiagnostics records how much of a page's visible text survived
+// conversion. Dropped maps an element descriptor such as "div.navbox" to the
+// number of its words missing from the output.
+type PageDiagnostics struct {
+	URL          string         `json:"url"`
+	SourceWords  int            `json:"source_words"`
+	MissingWords int            `json:"missing_words"`
+	Coverage     float64        `json:"coverage"`
+	Dropped      map[string]int `json:"dropped,omitempty"`
+}
+
+type DiagnosticsReport struct {
+	Pages        int               `json:"pages"`
+	SourceWords  int               `json:"source_words"`
+	MissingWords int               `json:"missing_words"`
+	Coverage     float64           `json:"coverage"`
+	Dropped      []DroppedElement  `json:"dropped"`
+	PageResults  []PageDiagnostics `json:"page_results"`
+}
+
+type DroppedElement struct {
+	Element string `json:"element"`
+	Pages   int    `json:"pages"`
+	Words   int    `json:"words"`
+}
+
+var (
+	pageDiagnostics []PageDiagnostics
+	diagnosticsMu   sync.Mutex
+)
+
+// diagnoseConversion compares the visible text of the page's
+// div.mw-parser-output with the produced markdown. Elements the converter
+// skips on purpose are not counted. A source word counts as kept if an unused
+// occurrence of it remains in the output, so the result is an approximation
+// that ignores word order.
+func diagnoseConversion(s *goquery.Selection, pageURL, markdown string) PageDiagnostics {
+	remaining := make(map[string]int)
+	for _, word := range textWords(markdown) {
+		remaining[word]++
+	}
+
+	d := PageDiagnostics{URL: pageURL, Dropped: make(map[string]int)}
+	content := s.Find("div.mw-parser-output").First()
+	content.Contents().Each(func(i int, s *goquery.Selection) {
+		total, missing := diagnoseNode(s, elementDescriptor(content), remaining, d.Dropped)
+		d.SourceWords += total
+		d.MissingWords += missing
+	})
+
+	d.Coverage = 1
+	if d.SourceWords > 0 {
+		d.Coverage = float64(d.SourceWords-d.MissingWords) / float64(d.SourceWords)
+	}
+	if len(d.Dropped) == 0 {
+		d.Dropped = nil
+	}
+	return d
+}
+
+// diagnoseNode consumes the node's words from remaining and returns how many
+// it had and how many were missing. Missing words are attributed to the
+// outermost element that lost all of its text, or to the text's parent when
+// only part of an element was lost.
+func diagnoseNode(s *goquery.Selection, parent string, remaining map[string]int, dropped map[string]int) (total, missing int) {
+	if goquery.NodeName(s) == "#text" {
+		for _, word := range textWords(s.Text()) {
+			total++
+			if remaining[word] > 0 {
+				remaining[word]--
+			} else {
+				missing++
+			}
+		}
+		if missing > 0 {
+			dropped[parent] += missing
+		}
+		return total, missing
+	}
+	if s.Is("script, style") || shouldSkipElement(s) {
+		return 0, 0
+	}
+
+	element := elementDescriptor(s)
+	local := make(map[string]int)
+	s.Contents().Each(func(i int, child *goquery.Selection) {
+		t, m := diagnoseNode(child, element, remaining, local)
+		total += t
+		missing += m
+	})
+
+	if missing > 0 && missing == total {
+		dropped[element] += missing
+		return total, missing
+	}
+	for key, words := range local {
+		dropped[key] += words
+	}
+	return total, missing
+}
+
+func elementDescriptor(s *goquery.Selection) string {
+	descriptor := goquery.NodeName(s)
+	for _, class := range strings.Fields(s.AttrOr("class", "")) {
+		descriptor += "." + class
+	}
+	return descriptor
+}
+
+func textWords(text string) []string {
+	return wordPattern.FindAllString(strings.ToLower(text), -1)
+}
+
+func recordDiagnostics(d PageDiagnostics) {
+	diagnosticsMu.Lock()
+	defer diagnosticsMu.Unlock()
+	pageDiagnostics = append(pageDiagnostics, d)
+}
+
+func buildDiagnosticsReport(pages []PageDiagnostics) DiagnosticsReport {
+	report := DiagnosticsReport{Pages: len(pages), Coverage: 1, Dropped: []DroppedElement{}, PageResults: pages}
+
+	byElement := make(map[string]*DroppedElement)
+	for _, page := range pages {
+		report.SourceWords += page.SourceWords
+		report.MissingWords += page.MissingWords
+		for element, words := range page.Dropped {
+			if byElement[element] == nil {
+				byElement[element] = &DroppedElement{Element: element}
+			}
+			byElement[element].Pages++
+			byElement[element].Words += words
+		}
+	}
+	if report.SourceWords > 0 {
+		report.Coverage = float64(report.SourceWords-report.MissingWords) / float64(report.SourceWords)
+	}
+
+	for _, element := range byElement {
+		report.Dropped = append(report.Dropped, *element)
+	}
+	sort.Slice(report.Dropped, func(i, j int) bool {
+		if report.Dropped[i].Words != report.Dropped[j].Words {
+			return report.Dropped[i].Words > report.Dropped[j].Words
+		}
+		return report.Dropped[i].Element < report.Dropped[j].Element
+	})
+	sort.SliceStable(report.PageResults, func(i, j int) bool {
+		if report.PageResults[i].Coverage != report.PageResults[j].Coverage {
+			return report.PageResults[i].Coverage < report.PageResults[j].Coverage
+		}
+		return report.PageResults[i].URL < report.PageResults[j].URL
+	})
+	return report
+}
+
+func writeDiagnosticsReport(filename string) error {
+	diagnosticsMu.Lock()
+	report := buildDiagnosticsReport(append([]PageDiagnostics(nil), pageDiagnostics...))
+	diagnosticsMu.Unlock()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDiagnoseConversion(t *testing.T) {
+	html := `<div id="mw-content-text"><div class="mw-parser-output">
+		<p>Pacman is the package manager.</p>
+		<span class="mw-editsection">edit</span>
+		<div class="navbox"><span>Related articles</span> <a href="/title/Makepkg">makepkg</a></div>
+		<p>It tracks <span class="hidden">secret</span> dependencies.</p>
+	</div></div>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	markdown := "Pacman is the package manager.\n\nIt tracks dependencies."
+	got := diagnoseConversion(doc.Find("div#mw-content-text"), "https://wiki.archlinux.org/title/Pacman", markdown)
+
+	want := PageDiagnostics{
+		URL:          "https://wiki.archlinux.org/title/Pacman",
+		SourceWords:  12,
+		MissingWords: 4,
+		Coverage:     8.0 / 12.0,
+		Dropped:      map[string]int{"div.navbox": 3, "span.hidden": 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnoseConversion() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiagnoseConversionFixture(t *testing.T) {
+	f, err := os.Open("testdata/arch_linux.html")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	content := doc.Find("div#mw-content-text")
+	got := diagnoseConversion(content, "https://wiki.archlinux.org/title/Arch_Linux", ConvertToMarkdown(content))
+	if got.SourceWords == 0 {
+		t.Fatal("expected source words in fixture")
+	}
+	if got.Coverage < 0.95 {
+		t.Errorf("coverage = %.3f, want at least 0.95; dropped: %v", got.Coverage, got.Dropped)
+	}
+}
+
+func TestBuildDiagnosticsReport(t *testing.T) {
+	report := buildDiagnosticsReport([]PageDiagnostics{
+		{URL: "a", SourceWords: 10, MissingWords: 0, Coverage: 1},
+		{URL: "b", SourceWords: 10, MissingWords: 5, Coverage: 0.5, Dropped: map[string]int{"div.navbox": 4, "span": 1}},
+		{URL: "c", SourceWords: 20, MissingWords: 5, Coverage: 0.75, Dropped: map[string]int{"div.navbox": 5}},
+	})
+
+	if report.Pages != 3 || report.SourceWords != 40 || report.MissingWords != 10 || report.Coverage != 0.75 {
+		t.Errorf("totals = %d pages, %d words, %d missing, %.2f coverage", report.Pages, report.SourceWords, report.MissingWords, report.Coverage)
+	}
+
+	wantDropped := []DroppedElement{
+		{Element: "div.navbox", Pages: 2, Words: 9},
+		{Element: "span", Pages: 1, Words: 1},
+	}
+	if !reflect.DeepEqual(report.Dropped, wantDropped) {
+		t.Errorf("Dropped = %+v, want %+v", report.Dropped, wantDropped)
+	}
+
+	var order []string
+	for _, page := range report.PageResults {
+		order = append(order, page.URL)
+	}
+	if want := []string{"b", "c", "a"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("page order = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CrawlDiff lists the differences between two crawls, keyed by page URL.
+type CrawlDiff struct {
+	Old     string     `json:"old"`
+	New     string     `json:"new"`
+	Added   []string   `json:"added"`
+	Removed []string   `json:"removed"`
+	Changed []PageDiff `json:"changed"`
+}
+
+// PageDiff describes a page present in both crawls whose content or links
+// changed. Diff is a unified diff of the page body and Sections a per-section
+// summary, depending on the diff mode.
+type PageDiff struct {
+	URL          string          `json:"url"`
+	File         string          `json:"file"`
+	Diff         string          `json:"diff,omitempty"`
+	Sections     []SectionChange `json:"sections,omitempty"`
+	LinksAdded   []string        `json:"links_added,omitempty"`
+	LinksRemoved []string        `json:"links_removed,omitempty"`
+}
+
+type SectionChange struct {
+	Section string `json:"section"`
+	Change  string `json:"change"`
+}
+
+const diffContext = 3
+
+// maxDiffCells bounds the table diffLines builds for the lines that differ
+// between two pages. Larger rewrites are shown as a replacement of the whole
+// differing block.
+const maxDiffCells = 1 << 22
+
+// snapshotPage is a saved page as read back from a crawl's output directory.
+// Links is nil for the plain text and HTML formats, which do not list them.
+type snapshotPage struct {
+	File     string
+	Body     string
+	Sections []SectionEntry
+	Links    []string
+}
+
+func runDiff(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [flags] old new\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flags.Output(), "Compares two crawl output directories, or the manifest.jsonl files inside them.")
+		flags.PrintDefaults()
+	}
+	mode := flags.String("mode", "unified", "how to show changed content: unified, sections or none")
+	jsonOutput := flags.Bool("json", false, "write the differences as JSON")
+	flags.Parse(args)
+
+	if *mode != "unified" && *mode != "sections" && *mode != "none" {
+		return fmt.Errorf("unknown diff mode %q", *mode)
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected two crawls to compare, got %d", flags.NArg())
+	}
+
+	d, err := diffCrawls(flags.Arg(0), flags.Arg(1), *mode)
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	return writeDiffReport(stdout, d)
+}
+
+func diffCrawls(oldPath, newPath, mode string) (*CrawlDiff, error) {
+	oldDir, oldRecords, err := loadSnapshot(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newDir, newRecords, err := loadSnapshot(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &CrawlDiff{Old: oldPath, New: newPath, Added: []string{}, Removed: []string{}, Changed: []PageDiff{}}
+	for pageURL := range oldRecords {
+		if _, ok := newRecords[pageURL]; !ok {
+			d.Removed = append(d.Removed, pageURL)
+		}
+	}
+	var common []string
+	for pageURL := range newRecords {
+		if _, ok := oldRecords[pageURL]; ok {
+			common = append(common, pageURL)
+		} else {
+			d.Added = append(d.Added, pageURL)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(common)
+
+	for _, pageURL := range common {
+		oldPage, err := readSnapshotPage(oldDir, oldRecords[pageURL].File)
+		if err != nil {
+			return nil, err
+		}
+		newPage, err := readSnapshotPage(newDir, newRecords[pageURL].File)
+		if err != nil {
+			return nil, err
+		}
+		if change, changed := diffPages(oldPage, newPage, mode); changed {
+			change.URL = pageURL
+			d.Changed = append(d.Changed, change)
+		}
+	}
+	return d, nil
+}
+
+// loadSnapshot returns the output directory of a crawl and its manifest
+// records keyed by URL. path is either the directory or a manifest in it. A
+// directory without a manifest, written before crawls had one, is read page by
+// page instead.
+func loadSnapshot(path string) (string, map[string]PageRecord, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	var records []PageRecord
+	dir := path
+	if info.IsDir() {
+		records, err = readManifest(dir)
+		if os.IsNotExist(err) {
+			records, err = readSnapshotFiles(dir)
+		}
+	} else {
+		dir = filepath.Dir(path)
+		records, err = readManifestFile(path)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read manifest for %s: %v", path, err)
+	}
+
+	pages := make(map[string]PageRecord, len(records))
+	for _, record := range records {
+		pages[record.URL] = record
+	}
+	return dir, pages, nil
+}
+
+// readSnapshotFiles returns a record for every markdown and JSON page under
+// dir, keyed by the url in its front matter or JSON document.
+func readSnapshotFiles(dir string) ([]PageRecord, error) {
+	var records []PageRecord
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".md" && filepath.Ext(path) != ".json" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var pageURL string
+		if filepath.Ext(path) == ".json" {
+			var page jsonPage
+			if json.Unmarshal(data, &page) == nil {
+				pageURL = page.URL
+			}
+		} else {
+			pageURL = frontMatterURL(string(data))
+		}
+		if pageURL == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		records = append(records, PageRecord{URL: pageURL, File: rel})
+		return nil
+	})
+	return records, err
+}
+
+// frontMatterURL returns the url field of a page's front matter. Older crawls
+// wrote titles unquoted, so front matter that is not valid YAML is searched
+// line by line.
+func frontMatterURL(content string) string {
+	if meta, _, err := parseFrontMatter(content); err == nil {
+		return meta.URL
+	}
+	frontMatter, _, found := strings.Cut(content, "\n---\n")
+	if !strings.HasPrefix(content, "---\n") || !found {
+		return ""
+	}
+	for _, line := range strings.Split(frontMatter, "\n") {
+		if pageURL, ok := strings.CutPrefix(line, "url: "); ok {
+			return strings.TrimSpace(pageURL)
+		}
+	}
+	return ""
+}
+
+func readSnapshotPage(dir, file string) (snapshotPage, error) {
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return snapshotPage{}, err
+	}
+	page := snapshotPage{File: file, Body: string(data)}
+	if filepath.Ext(file) == ".json" {
+		return readJSONSnapshotPage(page)
+	}
+	if filepath.Ext(file) != ".md" {
+		return page, nil
+	}
+	meta, body, err := parseFrontMatter(page.Body)
+	if err != nil {
+		if _, body, found := strings.Cut(page.Body, "\n---\n\n"); found && frontMatterURL(page.Body) != "" {
+			page.Body = body
+			return page, nil
+		}
+		return snapshotPage{}, fmt.Errorf("%s: %v", filepath.Join(dir, file), err)
+	}
+	page.Body, page.Sections = body, meta.Sections
+	page.Links = []string{}
+	for _, link := range meta.Links {
+		page.Links = append(page.Links, link.URL)
+	}
+	return page, nil
+}
+
+// readJSONSnapshotPage compares a JSON page by its sections and links,
+// leaving out the metadata, which changes on every crawl.
+func readJSONSnapshotPage(page snapshotPage) (snapshotPage, error) {
+	var doc jsonPage
+	if err := json.Unmarshal([]byte(page.Body), &doc); err != nil {
+		return snapshotPage{}, fmt.Errorf("%s: %v", page.File, err)
+	}
+	page.Body, page.Sections = doc.pageText()
+	page.Links = []string{}
+	for _, link := range doc.Links {
+		page.Links = append(page.Links, link.URL)
+	}
+	return page, nil
+}
+
+func diffPages(oldPage, newPage snapshotPage, mode string) (PageDiff, bool) {
+	change := PageDiff{File: newPage.File}
+	change.LinksAdded, change.LinksRemoved = diffSets(oldPage.Links, newPage.Links)
+	if oldPage.Body == newPage.Body && len(change.LinksAdded) == 0 && len(change.LinksRemoved) == 0 {
+		return change, false
+	}
+	if oldPage.Body != newPage.Body {
+		switch mode {
+		case "unified":
+			change.Diff = unifiedDiff("old/"+oldPage.File, "new/"+newPage.File, oldPage.Body, newPage.Body)
+		case "sections":
+			change.Sections = diffSections(oldPage, newPage)
+		}
+	}
+	return change, true
+}
+
+// diffSets returns the values only in b and the values only in a, sorted.
+func diffSets(a, b []string) (added, removed []string) {
+	inA := make(map[string]bool, len(a))
+	for _, v := range a {
+		inA[v] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+		if !inA[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !inB[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// diffSections compares pages section by section. Sections are identified
+// by their heading path; text before the first heading is the introduction.
+func diffSections(oldPage, newPage snapshotPage) []SectionChange {
+	oldSections := splitSections(oldPage.Body, oldPage.Sections)
+	newSections := splitSections(newPage.Body, newPage.Sections)
+	oldText := make(map[string]string, len(oldSections))
+	for _, s := range oldSections {
+		oldText[s.key] = s.text
+	}
+
+	var changes []SectionChange
+	seen := make(map[string]bool, len(newSections))
+	for _, s := range newSections {
+		seen[s.key] = true
+		text, ok := oldText[s.key]
+		switch {
+		case !ok:
+			changes = append(changes, SectionChange{Section: s.key, Change: "added"})
+		case text != s.text:
+			changes = append(changes, SectionChange{Section: s.key, Change: "changed"})
+		}
+	}
+	for _, s := range oldSections {
+		if !seen[s.key] {
+			changes = append(changes, SectionChange{Section: s.key, Change: "removed"})
+		}
+	}
+	return changes
+}
+
+type bodySection struct {
+	key  string
+	text string
+}
+
+func splitSections(body string, entries []SectionEntry) []bodySection {
+	runes := []rune(body)
+	sections := []bodySection{{key: "(introduction)"}}
+	var path []string
+	var levels []int
+	seen := make(map[string]int)
+	start := 0
+	for _, entry := range entries {
+		if entry.Offset < start || entry.Offset > len(runes) {
+			continue
+		}
+		sections[len(sections)-1].text = string(runes[start:entry.Offset])
+		start = entry.Offset
+
+		for len(levels) > 0 && levels[len(levels)-1] >= entry.Level {
+			path, levels = path[:len(path)-1], levels[:len(levels)-1]
+		}
+		path, levels = append(path, entry.Title), append(levels, entry.Level)
+		key := strings.Join(path, " > ")
+		if seen[key]++; seen[key] > 1 {
+			key = fmt.Sprintf("%s (%d)", key, seen[key])
+		}
+		sections = append(sections, bodySection{key: key})
+	}
+	sections[len(sections)-1].text = string(runes[start:])
+	if strings.TrimSpace(sections[0].text) == "" {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns an edit script turning a into b, computed from the
+// longest common subsequence of the lines between any common prefix and
+// suffix, unless there are too many of them to compare.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, line := range ma {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range mb {
+			ops = append(ops, diffOp{'+', line})
+		}
+		for _, line := range a[len(a)-suffix:] {
+			ops = append(ops, diffOp{' ', line})
+		}
+		return ops
+	}
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	for i, j := 0, 0; i < len(ma) || j < len(mb); {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func unifiedDiff(oldName, newName, a, b string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// oldLine[k] and newLine[k] count the lines of each side before ops[k].
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for k, op := range ops {
+		oldLine[k+1], newLine[k+1] = oldLine[k], newLine[k]
+		if op.kind != '+' {
+			oldLine[k+1]++
+		}
+		if op.kind != '-' {
+			newLine[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; ; {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k + 1
+			} else if k-end >= 2*diffContext {
+				break
+			}
+		}
+		from, to := max(start-diffContext, 0), min(end+diffContext, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[from], oldLine[to]-oldLine[from]),
+			hunkRange(newLine[from], newLine[to]-newLine[from]))
+		for _, op := range ops[from:to] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func writeDiffReport(w io.Writer, d *CrawlDiff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Comparing %s with %s\n", d.Old, d.New)
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	for _, pageURL := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", pageURL)
+	}
+	for _, pageURL := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", pageURL)
+	}
+	for _, change := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", change.URL)
+		for _, link := range change.LinksAdded {
+			fmt.Fprintf(&b, "    link added: %s\n", link)
+		}
+		for _, link := range change.LinksRemoved {
+			fmt.Fprintf(&b, "    link removed: %s\n", link)
+		}
+		for _, section := range change.Sections {
+			fmt.Fprintf(&b, "    section %s: %s\n", section.Change, section.Section)
+		}
+		b.WriteString(change.Diff)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
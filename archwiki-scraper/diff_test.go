@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "identical",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n",
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "insert into empty",
+			a:    "",
+			b:    "new\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSections(t *testing.T) {
+	page := func(body string, entries ...SectionEntry) snapshotPage {
+		return snapshotPage{Body: body, Sections: locateSections(entries, body)}
+	}
+	install, tips := SectionEntry{Level: 2, Title: "Install"}, SectionEntry{Level: 3, Title: "Tips"}
+	oldPage := page("Intro\n\n## Install\n\nRun pacman.\n\n### Tips\n\nNone.\n\n## Usage\n\nOld usage.\n",
+		install, tips, SectionEntry{Level: 2, Title: "Usage"})
+	newPage := page("Intro\n\n## Install\n\nRun pacman.\n\n### Tips\n\nSome.\n\n## Removal\n\nRun pacman -R.\n",
+		install, tips, SectionEntry{Level: 2, Title: "Removal"})
+
+	want := []SectionChange{
+		{Section: "Install > Tips", Change: "changed"},
+		{Section: "Removal", Change: "added"},
+		{Section: "Usage", Change: "removed"},
+	}
+	if got := diffSections(oldPage, newPage); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSections() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffCrawls(t *testing.T) {
+	writeCrawl := func(pages map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		var manifest strings.Builder
+		for title, body := range pages {
+			meta := PageMeta{Title: title, URL: baseURL + "/title/" + title}
+			if title == "Pacman" {
+				meta.Links = []OutboundLink{{Kind: LinkWiki, URL: baseURL + "/title/" + body}}
+			}
+			frontMatter, err := renderFrontMatter(meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, title+".md"), []byte(frontMatter+"\n"+body+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			record, _ := json.Marshal(PageRecord{URL: meta.URL, File: title + ".md", Title: title})
+			manifest.Write(append(record, '\n'))
+		}
+		if err := os.WriteFile(filepath.Join(dir, validate.ManifestFile), []byte(manifest.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	oldDir := writeCrawl(map[string]string{"Pacman": "Systemd", "Systemd": "init", "Xorg": "display"})
+	newDir := writeCrawl(map[string]string{"Pacman": "Wayland", "Systemd": "init", "Wayland": "display"})
+
+	d, err := diffCrawls(oldDir, filepath.Join(newDir, validate.ManifestFile), "unified")
+	if err != nil {
+		t.Fatalf("diffCrawls() error = %v", err)
+	}
+	if want := []string{baseURL + "/title/Wayland"}; !reflect.DeepEqual(d.Added, want) {
+		t.Errorf("Added = %v, want %v", d.Added, want)
+	}
+	if want := []string{baseURL + "/title/Xorg"}; !reflect.DeepEqual(d.Removed, want) {
+		t.Errorf("Removed = %v, want %v", d.Removed, want)
+	}
+	want := []PageDiff{{
+		URL:          baseURL + "/title/Pacman",
+		File:         "Pacman.md",
+		Diff:         "--- old/Pacman.md\n+++ new/Pacman.md\n@@ -1 +1 @@\n-Systemd\n+Wayland\n",
+		LinksAdded:   []string{baseURL + "/title/Wayland"},
+		LinksRemoved: []string{baseURL + "/title/Systemd"},
+	}}
+	if !reflect.DeepEqual(d.Changed, want) {
+		t.Errorf("Changed = %+v, want %+v", d.Changed, want)
+	}
+
+	var report bytes.Buffer
+	if err := writeDiffReport(&report, d); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "1 added, 1 removed, 1 changed\n") {
+		t.Errorf("report missing summary:\n%s", report.String())
+	}
+}
+
+func TestDiffCrawlsWithoutManifest(t *testing.T) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(oldDir, "Pacman", "Tips.md"): "---\ntitle: Pacman/Tips: and tricks\nurl: " + baseURL + "/title/Pacman/Tips\ndate_scraped: 2024-01-01T00:00:00Z\n---\n\nOld tips.\n",
+		filepath.Join(oldDir, "Xorg.md"):           "---\ntitle: Xorg\nurl: " + baseURL + "/title/Xorg\ndate_scraped: 2024-01-01T00:00:00Z\n---\n\nDisplay.\n",
+		filepath.Join(oldDir, "notes.md"):          "No front matter.\n",
+	}
+	frontMatter, err := renderFrontMatter(PageMeta{Title: "Pacman/Tips", URL: baseURL + "/title/Pacman/Tips"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[filepath.Join(newDir, "Pacman~2FTips.md")] = frontMatter + "\nNew tips.\n"
+	for filename, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := diffCrawls(oldDir, newDir, "unified")
+	if err != nil {
+		t.Fatalf("diffCrawls() error = %v", err)
+	}
+	if want := []string{baseURL + "/title/Xorg"}; !reflect.DeepEqual(d.Removed, want) || len(d.Added) != 0 {
+		t.Errorf("Added = %v, Removed = %v, want only %v removed", d.Added, d.Removed, want)
+	}
+	if len(d.Changed) != 1 || !strings.Contains(d.Changed[0].Diff, "-Old tips.\n+New tips.\n") {
+		t.Errorf("Changed = %+v, want the tips page body diffed", d.Changed)
+	}
+}
+
+func TestDiffJSONCrawls(t *testing.T) {
+	writeCrawl := func(scraped time.Time, pages map[string]string) string {
+		t.Helper()
+		dir := t.TempDir()
+		for title, html := range pages {
+			meta := PageMeta{Title: title, URL: baseURL + "/title/" + title, DateScraped: scraped}
+			data, err := renderPage("json", parseTestDocument(t, html), filepath.Join(dir, title+".json"), meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, title+".json"), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+	oldDir := writeCrawl(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), map[string]string{
+		"Pacman":  `<p>Package manager.</p><h2 id="Usage">Usage</h2><p>Use <a href="/title/Systemd">systemd</a>.</p>`,
+		"Systemd": `<p>Init system.</p>`,
+	})
+	newDir := writeCrawl(time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC), map[string]string{
+		"Pacman":  `<p>Package manager.</p><h2 id="Usage">Usage</h2><p>Use <a href="/title/Wayland">Wayland</a>.</p>`,
+		"Systemd": `<p>Init system.</p>`,
+	})
+
+	d, err := diffCrawls(oldDir, newDir, "sections")
+	if err != nil {
+		t.Fatalf("diffCrawls() error = %v", err)
+	}
+	want := []PageDiff{{
+		URL:          baseURL + "/title/Pacman",
+		File:         "Pacman.json",
+		Sections:     []SectionChange{{Section: "Usage", Change: "changed"}},
+		LinksAdded:   []string{baseURL + "/title/Wayland"},
+		LinksRemoved: []string{baseURL + "/title/Systemd"},
+	}}
+	if !reflect.DeepEqual(d.Changed, want) || len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("diffCrawls() = %+v, want only %+v changed", d, want)
+	}
+}
+
+func TestDiffLinesLargeRewrite(t *testing.T) {
+	var a, b []string
+	for i := range 3000 {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	a = append([]string{"same"}, a...)
+	b = append([]string{"same"}, b...)
+
+	ops := diffLines(a, b)
+	if len(ops) != 6001 || ops[0] != (diffOp{' ', "same"}) || ops[1].kind != '-' || ops[3001].kind != '+' {
+		t.Errorf("diffLines() gave %d ops, want the common line then the whole block replaced", len(ops))
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+// Document is the format-independent representation of a converted wiki page.
+// Content before the first heading lives in Blocks; everything else is nested
+// under Sections according to heading level.
+type Document struct {
+	Title     string
+	Blocks    []Block
+	Sections  []*Section
+	Footnotes []Footnote
+}
+
+type Section struct {
+	Level    int
+	Title    string
+	Anchor   string
+	Blocks   []Block
+	Sections []*Section
+}
+
+type Footnote struct {
+	Label   string
+	Inlines []Inline
+}
+
+type Block interface {
+	isBlock()
+}
+
+type Paragraph struct {
+	Inlines []Inline
+}
+
+type List struct {
+	Ordered bool
+	Items   []ListItem
+}
+
+type ListItem struct {
+	Blocks []Block
+}
+
+type DefinitionList struct {
+	Items []Definition
+}
+
+type Definition struct {
+	Term   []Inline
+	Blocks []Block
+}
+
+// Table is a rectangular grid: cells spanning several rows or columns appear
+// at every position they cover, and short rows are padded with nil cells.
+type Table struct {
+	HeaderRows int
+	Rows       [][]*TableCell
+}
+
+type TableCell struct {
+	Header bool
+	Blocks []Block
+}
+
+type CodeBlock struct {
+	Language string
+	Caption  string
+	Code     string
+}
+
+type Admonition struct {
+	Kind   string
+	Blocks []Block
+}
+
+type Quote struct {
+	Blocks []Block
+}
+
+type Figure struct {
+	Image   Image
+	Caption []Inline
+}
+
+type RawHTML struct {
+	HTML string
+}
+
+func (Paragraph) isBlock()      {}
+func (List) isBlock()           {}
+func (DefinitionList) isBlock() {}
+func (Table) isBlock()          {}
+func (CodeBlock) isBlock()      {}
+func (Admonition) isBlock()     {}
+func (Quote) isBlock()          {}
+func (Figure) isBlock()         {}
+func (RawHTML) isBlock()        {}
+
+type Inline interface {
+	isInline()
+}
+
+type Text struct {
+	Text string
+}
+
+type Code struct {
+	Text string
+}
+
+type Emphasis struct {
+	Inlines []Inline
+}
+
+type Strong struct {
+	Inlines []Inline
+}
+
+type Link struct {
+	Href    string
+	Kind    LinkKind
+	Target  string
+	Inlines []Inline
+}
+
+type Image struct {
+	URL string
+	Alt string
+}
+
+type FootnoteRef struct {
+	Label string
+}
+
+type LineBreak struct{}
+
+func (Text) isInline()        {}
+func (Code) isInline()        {}
+func (Emphasis) isInline()    {}
+func (Strong) isInline()      {}
+func (Link) isInline()        {}
+func (Image) isInline()       {}
+func (FootnoteRef) isInline() {}
+func (LineBreak) isInline()   {}
+
+// WalkSections calls fn for every section in document order, along with the
+// titles of the section and all of its ancestors.
+func (d *Document) WalkSections(fn func(path []string, s *Section)) {
+	var walk func(path []string, sections []*Section)
+	walk = func(path []string, sections []*Section) {
+		for _, s := range sections {
+			sectionPath := append(path[:len(path):len(path)], s.Title)
+			fn(sectionPath, s)
+			walk(sectionPath, s.Sections)
+		}
+	}
+	walk(nil, d.Sections)
+}
+
+// Links returns every link in the document, including those in footnotes, in
+// document order.
+func (d *Document) Links() []Link {
+	var links []Link
+	collect := func(inlines []Inline) {
+		links = append(links, inlineLinks(inlines)...)
+	}
+	walkBlockInlines(d.Blocks, collect)
+	d.WalkSections(func(_ []string, s *Section) {
+		walkBlockInlines(s.Blocks, collect)
+	})
+	for _, footnote := range d.Footnotes {
+		collect(footnote.Inlines)
+	}
+	return links
+}
+
+func (d *Document) isEmpty() bool {
+	return len(d.Blocks) == 0 && len(d.Sections) == 0
+}
+
+func walkBlockInlines(blocks []Block, fn func([]Inline)) {
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case Paragraph:
+			fn(b.Inlines)
+		case List:
+			for _, item := range b.Items {
+				walkBlockInlines(item.Blocks, fn)
+			}
+		case DefinitionList:
+			for _, item := range b.Items {
+				fn(item.Term)
+				walkBlockInlines(item.Blocks, fn)
+			}
+		case Table:
+			seen := make(map[*TableCell]bool)
+			for _, row := range b.Rows {
+				for _, cell := range row {
+					if cell != nil && !seen[cell] {
+						seen[cell] = true
+						walkBlockInlines(cell.Blocks, fn)
+					}
+				}
+			}
+		case Admonition:
+			walkBlockInlines(b.Blocks, fn)
+		case Quote:
+			walkBlockInlines(b.Blocks, fn)
+		case Figure:
+			fn(b.Caption)
+		}
+	}
+}
+
+func inlineLinks(inlines []Inline) []Link {
+	var links []Link
+	for _, inline := range inlines {
+		switch in := inline.(type) {
+		case Link:
+			links = append(links, in)
+		case Emphasis:
+			links = append(links, inlineLinks(in.Inlines)...)
+		case Strong:
+			links = append(links, inlineLinks(in.Inlines)...)
+		}
+	}
+	return links
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current conversion output")
+
+func TestGoldenMarkdown(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/golden/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no golden fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".html")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(fixture)
+			if err != nil {
+				t.Fatalf("Failed to open fixture: %v", err)
+			}
+			defer f.Close()
+
+			doc, err := goquery.NewDocumentFromReader(f)
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got := ConvertToMarkdown(doc.Find("div#mw-content-text"))
+
+			golden := strings.TrimSuffix(fixture, ".html") + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden file (run go test -run TestGoldenMarkdown -update to create it): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("markdown for %s does not match %s\n--- got ---\n%s\n--- want ---\n%s", fixture, golden, got, want)
+			}
+		})
+	}
+}
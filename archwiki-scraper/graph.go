@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const linkGraphFile = "link_graph.jsonl"
+
+// GraphEdge is a link between two wiki pages, identified by their wiki paths.
+// Text is the anchor text of the first link from From to To.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+type GraphNode struct {
+	Path     string
+	Title    string
+	File     string
+	InDegree int
+	PageRank float64
+}
+
+type LinkGraph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+var (
+	graphEdges []GraphEdge
+	graphMutex sync.Mutex
+)
+
+// recordLinks adds an edge for every link from a saved page to a page the
+// crawler could follow.
+func recordLinks(pageURL string, links []OutboundLink) {
+	from := wikiPathFromURL(pageURL)
+	if from == "" {
+		return
+	}
+	graphMutex.Lock()
+	defer graphMutex.Unlock()
+	for _, link := range links {
+		if !(Link{Kind: link.Kind, Target: link.Target}).crawlable() {
+			continue
+		}
+		if to := wikiPathFromURL(link.URL); to != "" {
+			graphEdges = append(graphEdges, GraphEdge{From: from, To: to, Text: link.Text})
+		}
+	}
+}
+
+// writeLinkGraph writes the recorded edges with redirects resolved, sorted
+// and with at most one edge between any two pages.
+func writeLinkGraph(dir string) error {
+	graphMutex.Lock()
+	recorded := append([]GraphEdge(nil), graphEdges...)
+	graphMutex.Unlock()
+
+	redirectMutex.RLock()
+	canonical := func(path string) string {
+		if target, ok := redirects[path]; ok {
+			return target
+		}
+		return path
+	}
+	edges := recorded[:0]
+	for _, edge := range recorded {
+		edge.From, edge.To = canonical(edge.From), canonical(edge.To)
+		if edge.From != edge.To {
+			edges = append(edges, edge)
+		}
+	}
+	redirectMutex.RUnlock()
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	f, err := os.Create(filepath.Join(dir, linkGraphFile))
+	if err != nil {
+		return fmt.Errorf("failed to create link graph: %v", err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for i, edge := range edges {
+		if i > 0 && edge.From == edges[i-1].From && edge.To == edges[i-1].To {
+			continue
+		}
+		if err := enc.Encode(edge); err != nil {
+			return fmt.Errorf("failed to write link graph: %v", err)
+		}
+	}
+	return f.Close()
+}
+
+func readLinkGraph(dir string) ([]GraphEdge, error) {
+	f, err := os.Open(filepath.Join(dir, linkGraphFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var edges []GraphEdge
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var edge GraphEdge
+		if err := dec.Decode(&edge); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", linkGraphFile, err)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
+
+// buildLinkGraph returns a graph with a node for every saved page and every
+// page linked to, sorted by wiki path, with in-degrees and PageRank set.
+func buildLinkGraph(edges []GraphEdge, records []PageRecord, damping float64) *LinkGraph {
+	nodes := make(map[string]*GraphNode)
+	node := func(path string) *GraphNode {
+		if n, ok := nodes[path]; ok {
+			return n
+		}
+		n := &GraphNode{Path: path, Title: strings.ReplaceAll(path, "_", " ")}
+		nodes[path] = n
+		return n
+	}
+	for _, record := range records {
+		if path := wikiPathFromURL(record.URL); path != "" {
+			n := node(path)
+			n.Title, n.File = record.Title, record.File
+		}
+	}
+	for _, edge := range edges {
+		node(edge.From)
+		node(edge.To).InDegree++
+	}
+
+	g := &LinkGraph{Edges: edges}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Path < g.Nodes[j].Path })
+	g.computePageRank(damping)
+	return g
+}
+
+// computePageRank runs power iteration until the ranks settle. The rank of
+// pages without outgoing links is spread evenly over all pages, so the ranks
+// always sum to 1.
+func (g *LinkGraph) computePageRank(damping float64) {
+	n := len(g.Nodes)
+	if n == 0 {
+		return
+	}
+	index := make(map[string]int, n)
+	for i, node := range g.Nodes {
+		index[node.Path] = i
+	}
+	out := make([][]int, n)
+	for _, edge := range g.Edges {
+		out[index[edge.From]] = append(out[index[edge.From]], index[edge.To])
+	}
+
+	rank := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iteration := 0; iteration < 100; iteration++ {
+		next := make([]float64, n)
+		dangling := 0.0
+		for i, targets := range out {
+			if len(targets) == 0 {
+				dangling += rank[i]
+				continue
+			}
+			share := rank[i] / float64(len(targets))
+			for _, j := range targets {
+				next[j] += share
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		delta := 0.0
+		for i := range next {
+			next[i] = base + damping*next[i]
+			delta += math.Abs(next[i] - rank[i])
+		}
+		rank = next
+		if delta < 1e-10 {
+			break
+		}
+	}
+	for i := range g.Nodes {
+		g.Nodes[i].PageRank = rank[i]
+	}
+}
+
+// importance scales PageRank so that the highest ranked page scores 1.
+func (g *LinkGraph) importance() map[string]float64 {
+	top := 0.0
+	for _, n := range g.Nodes {
+		top = math.Max(top, n.PageRank)
+	}
+	scores := make(map[string]float64, len(g.Nodes))
+	for _, n := range g.Nodes {
+		if top > 0 {
+			scores[n.Path] = math.Round(n.PageRank/top*1e6) / 1e6
+		}
+	}
+	return scores
+}
+
+// writeImportance stores each saved markdown page's importance in its front
+// matter, and each JSON page's in its metadata. The manifest must be rewritten afterwards, as the files change.
+func writeImportance(dir string, g *LinkGraph) error {
+	scores := g.importance()
+	for _, n := range g.Nodes {
+		if filepath.Ext(n.File) == ".json" {
+			if err := writeJSONImportance(filepath.Join(dir, n.File), scores[n.Path]); err != nil {
+				return fmt.Errorf("%s: %v", n.File, err)
+			}
+			continue
+		}
+		if filepath.Ext(n.File) != ".md" {
+			continue
+		}
+		filename := filepath.Join(dir, n.File)
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		meta, body, err := parseFrontMatter(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %v", n.File, err)
+		}
+		if meta.Importance == scores[n.Path] {
+			continue
+		}
+		meta.Importance = scores[n.Path]
+		frontMatter, err := renderFrontMatter(meta)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, []byte(frontMatter+"\n"+body), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSONImportance sets the importance in the metadata of a JSON page.
+func writeJSONImportance(filename string, importance float64) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var page jsonPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return err
+	}
+	if page.Metadata.Importance == importance {
+		return nil
+	}
+	page.Metadata.Importance = importance
+	data, err = json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+func (g *LinkGraph) writeGraphML(w io.Writer) error {
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="title" for="node" attr.name="title" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="file" for="node" attr.name="file" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="in_degree" for="node" attr.name="in_degree" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="pagerank" for="node" attr.name="pagerank" attr.type="double"/>` + "\n")
+	b.WriteString(`  <key id="text" for="edge" attr.name="text" attr.type="string"/>` + "\n")
+	b.WriteString(`  <graph id="links" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", escape(n.Path))
+		fmt.Fprintf(&b, "      <data key=\"title\">%s</data>\n", escape(n.Title))
+		if n.File != "" {
+			fmt.Fprintf(&b, "      <data key=\"file\">%s</data>\n", escape(n.File))
+		}
+		fmt.Fprintf(&b, "      <data key=\"in_degree\">%d</data>\n", n.InDegree)
+		fmt.Fprintf(&b, "      <data key=\"pagerank\">%s</data>\n", formatRank(n.PageRank))
+		b.WriteString("    </node>\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge source=\"%s\" target=\"%s\">\n", escape(e.From), escape(e.To))
+		fmt.Fprintf(&b, "      <data key=\"text\">%s</data>\n", escape(e.Text))
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *LinkGraph) writeDOT(w io.Writer) error {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s, in_degree=%d, pagerank=%s];\n",
+			quote(n.Path), quote(n.Title), n.InDegree, formatRank(n.PageRank))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", quote(e.From), quote(e.To), quote(e.Text))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *LinkGraph) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"source", "target", "text"})
+	for _, e := range g.Edges {
+		cw.Write([]string{e.From, e.To, e.Text})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeScoresCSV writes one row per page, highest PageRank first.
+func (g *LinkGraph) writeScoresCSV(w io.Writer) error {
+	nodes := append([]GraphNode(nil), g.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].PageRank > nodes[j].PageRank })
+	scores := g.importance()
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"path", "title", "file", "in_degree", "pagerank", "importance"})
+	for _, n := range nodes {
+		cw.Write([]string{n.Path, n.Title, n.File, strconv.Itoa(n.InDegree), formatRank(n.PageRank), formatRank(scores[n.Path])})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatRank(rank float64) string {
+	return strconv.FormatFloat(rank, 'g', 6, 64)
+}
+
+var graphFormats = map[string]func(*LinkGraph, io.Writer) error{
+	"graphml": (*LinkGraph).writeGraphML,
+	"dot":     (*LinkGraph).writeDOT,
+	"csv":     (*LinkGraph).writeCSV,
+	"scores":  (*LinkGraph).writeScoresCSV,
+}
+
+func runGraph(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s graph [flags] [output_dir]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flags.Output(), "Computes in-degree and PageRank from the link graph of a finished crawl.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "scores", "export format: graphml, dot, csv (edge list) or scores (one row per page)")
+	exportFile := flags.String("o", "", "file to write the export to (default: stdout)")
+	damping := flags.Float64("damping", 0.85, "PageRank damping factor")
+	importance := flags.Bool("importance", true, "write an importance score into the front matter of each markdown page, or the metadata of each JSON page, and update the manifest")
+	flags.Parse(args)
+
+	export, ok := graphFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown graph format %q", *format)
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one output directory, got %d", flags.NArg())
+	}
+	dir := "output"
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	edges, err := readLinkGraph(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read link graph: %v", err)
+	}
+	records, err := readManifest(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	g := buildLinkGraph(edges, records, *damping)
+
+	if *importance && len(records) > 0 {
+		if err := writeImportance(dir, g); err != nil {
+			return fmt.Errorf("failed to write importance: %v", err)
+		}
+		if err := writeManifestRecords(dir, records); err != nil {
+			return fmt.Errorf("failed to update manifest: %v", err)
+		}
+	}
+
+	if *exportFile == "" {
+		return export(g, stdout)
+	}
+	f, err := os.Create(*exportFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := export(g, f); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteLinkGraph(t *testing.T) {
+	resetRedirects(t)
+	defer func(edges []GraphEdge) { graphEdges = edges }(graphEdges)
+	graphEdges = nil
+
+	recordRedirect("AUR", "Arch_User_Repository")
+	recordLinks("https://wiki.archlinux.org/title/Pacman", []OutboundLink{
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/AUR#Installing", Text: "AUR", Target: "AUR"},
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Arch_User_Repository", Text: "user repository", Target: "Arch User Repository"},
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Pacman#Usage", Text: "usage", Target: "Pacman"},
+		{Kind: LinkNamespace, URL: "https://wiki.archlinux.org/title/Talk:Pacman", Text: "talk", Target: "Talk:Pacman"},
+		{Kind: LinkNamespace, URL: "https://wiki.archlinux.org/title/Category:Package_manager", Text: "Package manager", Target: "Category:Package manager"},
+		{Kind: LinkExternal, URL: "https://archlinux.org/", Text: "Arch Linux"},
+	})
+	recordLinks("https://wiki.archlinux.org/title/Arch_User_Repository", []OutboundLink{
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Pacman", Text: "pacman", Target: "Pacman"},
+	})
+
+	dir := t.TempDir()
+	if err := writeLinkGraph(dir); err != nil {
+		t.Fatalf("writeLinkGraph() error = %v", err)
+	}
+	got, err := readLinkGraph(dir)
+	if err != nil {
+		t.Fatalf("readLinkGraph() error = %v", err)
+	}
+	want := []GraphEdge{
+		{From: "Arch_User_Repository", To: "Pacman", Text: "pacman"},
+		{From: "Pacman", To: "Arch_User_Repository", Text: "AUR"},
+		{From: "Pacman", To: "Category:Package_manager", Text: "Package manager"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("link graph = %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildLinkGraph(t *testing.T) {
+	edges := []GraphEdge{
+		{From: "A", To: "B"},
+		{From: "B", To: "C"},
+		{From: "C", To: "A"},
+		{From: "D", To: "A"},
+	}
+	records := []PageRecord{{URL: "https://wiki.archlinux.org/title/A", File: "A.md", Title: "Page A"}}
+	g := buildLinkGraph(edges, records, 0.85)
+
+	var paths []string
+	var inDegrees []int
+	total := 0.0
+	for _, n := range g.Nodes {
+		paths = append(paths, n.Path)
+		inDegrees = append(inDegrees, n.InDegree)
+		total += n.PageRank
+	}
+	if want := []string{"A", "B", "C", "D"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("nodes = %v, want %v", paths, want)
+	}
+	if want := []int{2, 1, 1, 0}; !reflect.DeepEqual(inDegrees, want) {
+		t.Errorf("in-degrees = %v, want %v", inDegrees, want)
+	}
+	if g.Nodes[0].Title != "Page A" || g.Nodes[0].File != "A.md" {
+		t.Errorf("node A = %+v, want title and file from the manifest", g.Nodes[0])
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Errorf("PageRank sums to %v, want 1", total)
+	}
+	if a, d := g.Nodes[0].PageRank, g.Nodes[3].PageRank; a <= d || math.Abs(d-0.15/4) > 1e-6 {
+		t.Errorf("PageRank A = %v, D = %v, want A ranked above an unlinked D at the teleport rank", a, d)
+	}
+	if score := g.importance()["A"]; score != 1 {
+		t.Errorf("importance of A = %v, want 1", score)
+	}
+}
+
+func TestWriteImportance(t *testing.T) {
+	dir := t.TempDir()
+	frontMatter, err := renderFrontMatter(PageMeta{Title: "A", URL: "https://wiki.archlinux.org/title/A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "Links to [B](B.md).\n"
+	if err := os.WriteFile(filepath.Join(dir, "A.md"), []byte(frontMatter+"\n"+body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	records := []PageRecord{{URL: "https://wiki.archlinux.org/title/A", File: "A.md"}}
+	g := buildLinkGraph([]GraphEdge{{From: "A", To: "B"}}, records, 0.85)
+	if err := writeImportance(dir, g); err != nil {
+		t.Fatalf("writeImportance() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "A.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, gotBody, err := parseFrontMatter(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := g.importance()["A"]; meta.Importance != want || want <= 0 || want >= 1 {
+		t.Errorf("importance = %v, want %v", meta.Importance, want)
+	}
+	if gotBody != body {
+		t.Errorf("body = %q, want %q", gotBody, body)
+	}
+}
+
+func TestWriteImportanceJSON(t *testing.T) {
+	dir := t.TempDir()
+	doc := parseTestDocument(t, `<p>Links to <a href="/title/B">B</a>.</p>`)
+	data, err := renderPage("json", doc, filepath.Join(dir, "A.json"), PageMeta{Title: "A", URL: "https://wiki.archlinux.org/title/A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "A.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	records := []PageRecord{{URL: "https://wiki.archlinux.org/title/A", File: "A.json"}}
+	g := buildLinkGraph([]GraphEdge{{From: "A", To: "B"}}, records, 0.85)
+	if err := writeImportance(dir, g); err != nil {
+		t.Fatalf("writeImportance() error = %v", err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "A.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page jsonPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	if want := g.importance()["A"]; page.Metadata.Importance != want || want <= 0 {
+		t.Errorf("importance = %v, want %v", page.Metadata.Importance, want)
+	}
+	if len(page.Links) != 1 || page.Links[0].Kind != LinkWiki || page.Sections[0].Content != "Links to B." {
+		t.Errorf("page = %+v, want its content kept", page)
+	}
+}
+
+func TestRunGraphUpdatesManifest(t *testing.T) {
+	dir := t.TempDir()
+	frontMatter, err := renderFrontMatter(PageMeta{Title: "A", URL: "https://wiki.archlinux.org/title/A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"A.md":        frontMatter + "\nLinks to [B](B.md).\n",
+		linkGraphFile: `{"from":"A","to":"B"}` + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeManifestRecords(dir, []PageRecord{{URL: "https://wiki.archlinux.org/title/A", File: "A.md"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runGraph([]string{dir}, io.Discard); err != nil {
+		t.Fatalf("runGraph() error = %v", err)
+	}
+
+	records, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "A.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Bytes != int64(len(data)) || records[0].ContentHash != contentHash(string(data)) {
+		t.Errorf("manifest = %+v, want it to describe the rewritten A.md", records)
+	}
+}
+
+func TestGraphExports(t *testing.T) {
+	g := buildLinkGraph([]GraphEdge{{From: "A&B", To: `C"D`, Text: "see <here>"}}, nil, 0.85)
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"graphml", []string{`<node id="A&amp;B">`, `<edge source="A&amp;B" target="C&#34;D">`, `<data key="text">see &lt;here&gt;</data>`, `<data key="in_degree">1</data>`}},
+		{"dot", []string{`"A&B" [label="A&B", in_degree=0,`, `"A&B" -> "C\"D" [label="see <here>"];`}},
+		{"csv", []string{"source,target,text\n", `A&B,"C""D",see <here>` + "\n"}},
+		{"scores", []string{"path,title,file,in_degree,pagerank,importance\n", `"C""D","C""D",,1,`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := graphFormats[tt.format](g, &buf); err != nil {
+				t.Fatalf("export error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("export missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
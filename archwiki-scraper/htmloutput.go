@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// sanitizedElements lists the elements kept in raw HTML fragments and the
+// attributes each may keep. Other elements are replaced by their content.
+var sanitizedElements = map[string][]string{
+	"table": nil, "caption": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+	"th": {"colspan", "rowspan"}, "td": {"colspan", "rowspan"},
+	"p": nil, "br": nil, "ul": nil, "ol": nil, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+	"pre": nil, "code": nil, "em": nil, "strong": nil, "i": nil, "b": nil, "sub": nil, "sup": nil,
+	"a": {"href"}, "img": {"src", "alt"},
+}
+
+// RenderHTML writes the document as a standalone HTML page containing only
+// structural markup: no scripts, styles or wiki chrome.
+func RenderHTML(doc *Document, title string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n</head>\n<body>\n")
+	b.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	htmlBlocks(&b, doc.Blocks)
+	doc.WalkSections(func(_ []string, s *Section) {
+		level := min(s.Level, 6)
+		if s.Anchor != "" {
+			fmt.Fprintf(&b, "<h%d id=\"%s\">%s</h%d>\n", level, html.EscapeString(s.Anchor), html.EscapeString(s.Title), level)
+		} else {
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", level, html.EscapeString(s.Title), level)
+		}
+		htmlBlocks(&b, s.Blocks)
+	})
+	if len(doc.Footnotes) > 0 {
+		b.WriteString("<hr>\n<ol>\n")
+		for _, footnote := range doc.Footnotes {
+			fmt.Fprintf(&b, "<li id=\"fn-%s\">%s</li>\n", html.EscapeString(footnote.Label), htmlInlines(footnote.Inlines))
+		}
+		b.WriteString("</ol>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+func htmlBlocks(b *strings.Builder, blocks []Block) {
+	for _, block := range blocks {
+		htmlBlock(b, block)
+	}
+}
+
+func htmlBlock(b *strings.Builder, block Block) {
+	switch bl := block.(type) {
+	case Paragraph:
+		b.WriteString("<p>" + strings.TrimSpace(htmlInlines(bl.Inlines)) + "</p>\n")
+	case List:
+		tag := "ul"
+		if bl.Ordered {
+			tag = "ol"
+		}
+		b.WriteString("<" + tag + ">\n")
+		for _, item := range bl.Items {
+			b.WriteString("<li>")
+			htmlBlocks(b, item.Blocks)
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</" + tag + ">\n")
+	case DefinitionList:
+		b.WriteString("<dl>\n")
+		for _, item := range bl.Items {
+			if len(item.Term) > 0 {
+				b.WriteString("<dt>" + strings.TrimSpace(htmlInlines(item.Term)) + "</dt>\n")
+			}
+			b.WriteString("<dd>")
+			htmlBlocks(b, item.Blocks)
+			b.WriteString("</dd>\n")
+		}
+		b.WriteString("</dl>\n")
+	case Table:
+		b.WriteString("<table>\n")
+		for i, row := range bl.Rows {
+			b.WriteString("<tr>")
+			for j, cell := range row {
+				// A spanning cell fills every position it covers in the grid
+				// and is written once, from its top left position.
+				if cell != nil && (j > 0 && row[j-1] == cell || i > 0 && bl.Rows[i-1][j] == cell) {
+					continue
+				}
+				tag := "td"
+				if i < bl.HeaderRows || cell != nil && cell.Header {
+					tag = "th"
+				}
+				b.WriteString("<" + tag)
+				if cell != nil {
+					colspan, rowspan := 1, 1
+					for j+colspan < len(row) && row[j+colspan] == cell {
+						colspan++
+					}
+					for i+rowspan < len(bl.Rows) && bl.Rows[i+rowspan][j] == cell {
+						rowspan++
+					}
+					if colspan > 1 {
+						fmt.Fprintf(b, " colspan=\"%d\"", colspan)
+					}
+					if rowspan > 1 {
+						fmt.Fprintf(b, " rowspan=\"%d\"", rowspan)
+					}
+				}
+				b.WriteString(">")
+				if cell != nil {
+					htmlBlocks(b, cell.Blocks)
+				}
+				b.WriteString("</" + tag + ">")
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>\n")
+	case CodeBlock:
+		if bl.Caption != "" {
+			b.WriteString("<p><code>" + html.EscapeString(bl.Caption) + "</code></p>\n")
+		}
+		if bl.Language != "" {
+			fmt.Fprintf(b, "<pre><code class=\"language-%s\">", html.EscapeString(bl.Language))
+		} else {
+			b.WriteString("<pre><code>")
+		}
+		b.WriteString(html.EscapeString(bl.Code) + "</code></pre>\n")
+	case Admonition:
+		kind := strings.ToUpper(bl.Kind[:1]) + bl.Kind[1:]
+		b.WriteString("<aside>\n<p><strong>" + kind + ":</strong></p>\n")
+		htmlBlocks(b, bl.Blocks)
+		b.WriteString("</aside>\n")
+	case Quote:
+		b.WriteString("<blockquote>\n")
+		htmlBlocks(b, bl.Blocks)
+		b.WriteString("</blockquote>\n")
+	case Figure:
+		b.WriteString("<figure>" + htmlInlines([]Inline{bl.Image}))
+		if len(bl.Caption) > 0 {
+			b.WriteString("<figcaption>" + strings.TrimSpace(htmlInlines(bl.Caption)) + "</figcaption>")
+		}
+		b.WriteString("</figure>\n")
+	case RawHTML:
+		b.WriteString(sanitizeHTML(bl.HTML) + "\n")
+	}
+}
+
+// sanitizeHTML reduces a fragment of wiki HTML to structural markup, dropping
+// scripts, styles, classes and any link that does not point at a web page.
+func sanitizeHTML(fragment string) string {
+	return sanitizeHTMLLinks(fragment, webHref)
+}
+
+// sanitizeHTMLLinks is sanitizeHTML with href choosing where each link
+// points, or dropping it when href returns "".
+func sanitizeHTMLLinks(fragment string, href func(string) string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	sanitizeNodes(&b, doc.Find("body").Contents(), href)
+	return strings.TrimSpace(b.String())
+}
+
+// webHref returns the absolute URL of a link, or "" if it does not point at a
+// web page.
+func webHref(href string) string {
+	href = absoluteURL(href)
+	if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+		return ""
+	}
+	return href
+}
+
+func sanitizeNodes(b *strings.Builder, nodes *goquery.Selection, href func(string) string) {
+	nodes.Each(func(_ int, s *goquery.Selection) {
+		name := goquery.NodeName(s)
+		switch name {
+		case "#text":
+			b.WriteString(html.EscapeString(s.Text()))
+			return
+		case "#comment", "script", "style":
+			return
+		}
+
+		attrs, ok := sanitizedElements[name]
+		if !ok {
+			sanitizeNodes(b, s.Contents(), href)
+			return
+		}
+		b.WriteString("<" + name)
+		for _, attr := range s.Get(0).Attr {
+			if !slices.Contains(attrs, attr.Key) {
+				continue
+			}
+			value := attr.Val
+			switch attr.Key {
+			case "href":
+				value = href(value)
+			case "src":
+				value = webHref(absoluteMediaURL(value))
+			}
+			if (attr.Key == "href" || attr.Key == "src") && value == "" {
+				continue
+			}
+			fmt.Fprintf(b, " %s=\"%s\"", attr.Key, html.EscapeString(value))
+		}
+		b.WriteString(">")
+		if name == "br" || name == "img" {
+			return
+		}
+		sanitizeNodes(b, s.Contents(), href)
+		b.WriteString("</" + name + ">")
+	})
+}
+
+func htmlInlines(inlines []Inline) string {
+	var b strings.Builder
+	for _, inline := range inlines {
+		switch in := inline.(type) {
+		case Text:
+			b.WriteString(html.EscapeString(in.Text))
+		case Code:
+			b.WriteString("<code>" + html.EscapeString(in.Text) + "</code>")
+		case Emphasis:
+			b.WriteString("<em>" + htmlInlines(in.Inlines) + "</em>")
+		case Strong:
+			b.WriteString("<strong>" + htmlInlines(in.Inlines) + "</strong>")
+		case Link:
+			text := htmlInlines(in.Inlines)
+			if plain := plainInlines(in.Inlines); in.displayText(plain) != plain {
+				text = html.EscapeString(in.displayText(plain))
+			}
+			if in.namesPackage(plainInlines(in.Inlines)) {
+				text = "<code>" + text + "</code>"
+			}
+			href := absoluteURL(in.renderedHref())
+			if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+				fmt.Fprintf(&b, "<a href=\"%s\">%s</a>", html.EscapeString(href), text)
+			} else {
+				b.WriteString(text)
+			}
+		case Image:
+			fmt.Fprintf(&b, "<img src=\"%s\" alt=\"%s\">", html.EscapeString(in.URL), html.EscapeString(in.Alt))
+		case FootnoteRef:
+			label := html.EscapeString(in.Label)
+			fmt.Fprintf(&b, "<sup><a href=\"#fn-%s\">[%s]</a></sup>", label, label)
+		case LineBreak:
+			b.WriteString("<br>")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type LinkKind string
+
+const (
+	LinkWiki      LinkKind = "wiki"
+	LinkNamespace LinkKind = "namespace"
+	LinkAnchor    LinkKind = "anchor"
+	LinkPackage   LinkKind = "package"
+	LinkAUR       LinkKind = "aur"
+	LinkManPage   LinkKind = "manpage"
+	LinkInterwiki LinkKind = "interwiki"
+	LinkExternal  LinkKind = "external"
+	LinkOther     LinkKind = "other"
+)
+
+var wikiNamespaces = map[string]bool{
+	"ArchWiki":      true,
+	"Category":      true,
+	"DeveloperWiki": true,
+	"Help":          true,
+	"File":          false,
+	"Media":         false,
+	"MediaWiki":     false,
+	"Module":        false,
+	"Special":       false,
+	"Talk":          false,
+	"Template":      false,
+	"User":          false,
+}
+
+var (
+	officialPackagePath = regexp.MustCompile(`^/packages/[^/]+/[^/]+/([^/]+)/?$`)
+	aurPackagePath      = regexp.MustCompile(`^/packages/([^/]+)/?$`)
+	manPageSection      = regexp.MustCompile(`^(.+)\.(\d\w*)$`)
+)
+
+// OutboundLink is a deduplicated link from a page, as recorded in its
+// metadata.
+type OutboundLink struct {
+	Kind   LinkKind `json:"kind" yaml:"kind"`
+	URL    string   `json:"url" yaml:"url"`
+	Text   string   `json:"text" yaml:"text"`
+	Target string   `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// classifyLink resolves an href found on a wiki page. interwikiTitle is the
+// title attribute of links MediaWiki marks as interwiki (class "extiw").
+func classifyLink(href, interwikiTitle string) Link {
+	if strings.HasPrefix(href, "#") {
+		return Link{Href: href, Kind: LinkAnchor, Target: strings.TrimPrefix(href, "#")}
+	}
+	if strings.HasPrefix(href, "//") {
+		href = "https:" + href
+	}
+
+	if strings.HasPrefix(href, "/title/") {
+		title := strings.TrimPrefix(strings.SplitN(href, "#", 2)[0], "/title/")
+		if unescaped, err := url.PathUnescape(title); err == nil {
+			title = unescaped
+		}
+		title = strings.ReplaceAll(title, "_", " ")
+		if ns, _, found := strings.Cut(title, ":"); found && isNamespace(ns) {
+			return Link{Href: href, Kind: LinkNamespace, Target: title}
+		}
+		return Link{Href: href, Kind: LinkWiki, Target: title}
+	}
+
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return Link{Href: href, Kind: LinkOther}
+	}
+
+	if interwikiTitle != "" {
+		return Link{Href: href, Kind: LinkInterwiki, Target: interwikiTitle}
+	}
+
+	switch u.Host {
+	case "archlinux.org", "www.archlinux.org":
+		if m := officialPackagePath.FindStringSubmatch(u.Path); m != nil {
+			return Link{Href: href, Kind: LinkPackage, Target: m[1]}
+		}
+		if u.Path == "/packages/" || u.Path == "/packages" {
+			if name := u.Query().Get("name"); name != "" {
+				return Link{Href: href, Kind: LinkPackage, Target: name}
+			}
+		}
+	case "aur.archlinux.org":
+		if m := aurPackagePath.FindStringSubmatch(u.Path); m != nil {
+			return Link{Href: href, Kind: LinkAUR, Target: m[1]}
+		}
+	case "man.archlinux.org":
+		if strings.HasPrefix(u.Path, "/man/") {
+			return Link{Href: href, Kind: LinkManPage, Target: manPageTarget(u.Path)}
+		}
+	}
+
+	return Link{Href: href, Kind: LinkExternal}
+}
+
+func isNamespace(ns string) bool {
+	_, known := wikiNamespaces[ns]
+	return known || strings.HasSuffix(ns, " talk")
+}
+
+func manPageTarget(manPath string) string {
+	name := strings.TrimSuffix(path.Base(manPath), ".en")
+	if m := manPageSection.FindStringSubmatch(name); m != nil {
+		return m[1] + "(" + m[2] + ")"
+	}
+	return name
+}
+
+// renderedHref returns the URL a rendered link points at. Package links point
+// at the package's canonical page, and links to wiki pages that are never
+// scraped point at the live wiki.
+func (l Link) renderedHref() string {
+	switch l.Kind {
+	case LinkPackage:
+		return "https://archlinux.org/packages/?name=" + url.QueryEscape(l.Target)
+	case LinkAUR:
+		return "https://aur.archlinux.org/packages/" + url.PathEscape(l.Target)
+	case LinkNamespace:
+		if !l.crawlable() {
+			return absoluteURL(l.Href)
+		}
+	}
+	return l.Href
+}
+
+// displayText returns the text to show for a link labelled text. Man page
+// links labelled with the bare name gain their section, as in "pacman(8)".
+func (l Link) displayText(text string) string {
+	if l.Kind == LinkManPage {
+		if name, _, _ := strings.Cut(l.Target, "("); text == name {
+			return l.Target
+		}
+	}
+	return text
+}
+
+// namesPackage reports whether the link is labelled with the name of the
+// package it points at, which renderers show as code.
+func (l Link) namesPackage(text string) bool {
+	return (l.Kind == LinkPackage || l.Kind == LinkAUR) && text == l.Target
+}
+
+// crawlable reports whether the link points at a wiki page whose content is
+// worth scraping.
+func (l Link) crawlable() bool {
+	switch l.Kind {
+	case LinkWiki:
+		return true
+	case LinkNamespace:
+		ns, _, _ := strings.Cut(l.Target, ":")
+		return wikiNamespaces[ns]
+	}
+	return false
+}
+
+// OutboundLinks returns the page's links to other pages and sites, one entry
+// per URL, in the order they first appear.
+func (d *Document) OutboundLinks() []OutboundLink {
+	seen := make(map[string]bool)
+	var links []OutboundLink
+	for _, link := range d.Links() {
+		if link.Kind == LinkAnchor || link.Kind == LinkOther {
+			continue
+		}
+		linkURL := absoluteURL(link.Href)
+		if seen[linkURL] {
+			continue
+		}
+		seen[linkURL] = true
+		links = append(links, OutboundLink{
+			Kind:   link.Kind,
+			URL:    linkURL,
+			Text:   strings.TrimSpace(plainInlines(link.Inlines)),
+			Target: link.Target,
+		})
+	}
+	return links
+}
@@ -1,54 +1,181 @@
 package main
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestConvertWikiLinks(t *testing.T) {
 	tests := []struct {
-		name        string
-		content     string
-		currentFile string
-		want        string
+		name    string
+		content string
+		want    string
 	}{
 		{
-			name:        "simple link",
-			content:     "[GNU](/title/GNU)",
-			currentFile: "output/Arch_Linux.md",
-			want:        "[GNU](GNU.md)",
+			name:    "simple link",
+			content: "[GNU](/title/GNU)",
+			want:    "[GNU](GNU.md)",
 		},
 		{
-			name:        "link with anchor",
-			content:     "[Project Leader](/title/DeveloperWiki:Project_Leader#history)",
-			currentFile: "output/Arch_Linux.md",
-			want:        "[Project Leader](DeveloperWiki:Project_Leader.md#history)",
+			name:    "link with anchor",
+			content: "[Project Leader](/title/DeveloperWiki:Project_Leader#history)",
+			want:    "[Project Leader](DeveloperWiki~3AProject_Leader.md#history)",
 		},
 		{
-			name:        "link from nested directory",
-			content:     "[Arch Linux](/title/Arch_Linux)",
-			currentFile: "output/DeveloperWiki/Project_Leader.md",
-			want:        "[Arch Linux](../Arch_Linux.md)",
+			name:    "link to subpage",
+			content: "[Tips](/title/Pacman/Tips_and_tricks)",
+			want:    "[Tips](Pacman~2FTips_and_tricks.md)",
 		},
 		{
-			name:        "multiple links",
-			content:     "Check out [GNU](/title/GNU) and [systemd](/title/Systemd)",
-			currentFile: "output/Arch_Linux.md",
-			want:        "Check out [GNU](GNU.md) and [systemd](Systemd.md)",
+			name:    "percent-encoded title",
+			content: "[Café](/title/Caf%C3%A9)",
+			want:    "[Café](Café.md)",
 		},
 		{
-			name:        "non-wiki links unchanged",
-			content:     "[external](https://example.com) and [GNU](/title/GNU)",
-			currentFile: "output/Arch_Linux.md",
-			want:        "[external](https://example.com) and [GNU](GNU.md)",
+			name:    "parenthesised percent-encoded title",
+			content: "[y](/title/Installation_guide_(Espa%C3%B1ol)) and [C++](/title/C%2B%2B_(language)#Tools).",
+			want:    "[y](Installation_guide_~28Español~29.md) and [C++](C~2B~2B_~28language~29.md#Tools).",
+		},
+		{
+			name:    "multiple links",
+			content: "Check out [GNU](/title/GNU) and [systemd](/title/Systemd)",
+			want:    "Check out [GNU](GNU.md) and [systemd](Systemd.md)",
+		},
+		{
+			name:    "non-wiki links unchanged",
+			content: "[external](https://example.com) and [GNU](/title/GNU)",
+			want:    "[external](https://example.com) and [GNU](GNU.md)",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := convertWikiLinks(tt.content, tt.currentFile)
+			got := convertWikiLinks(tt.content)
 			if got != tt.want {
 				t.Errorf("convertWikiLinks() = %v, want %v", got, tt.want)
 			}
 		})
 	}
-} 
\ No newline at end of file
+}
+
+func TestClassifyLink(t *testing.T) {
+	tests := []struct {
+		name           string
+		href           string
+		interwikiTitle string
+		wantKind       LinkKind
+		wantTarget     string
+		wantCrawlable  bool
+	}{
+		{"wiki page", "/title/Arch_Linux", "", LinkWiki, "Arch Linux", true},
+		{"wiki page with anchor", "/title/Pacman#Usage", "", LinkWiki, "Pacman", true},
+		{"encoded title", "/title/Stra%C3%9Fe", "", LinkWiki, "Straße", true},
+		{"content namespace", "/title/Help:Reading", "", LinkNamespace, "Help:Reading", true},
+		{"category", "/title/Category:Networking", "", LinkNamespace, "Category:Networking", true},
+		{"special page", "/title/Special:Search", "", LinkNamespace, "Special:Search", false},
+		{"talk page", "/title/User_talk:Foo", "", LinkNamespace, "User talk:Foo", false},
+		{"colon in main namespace", "/title/Foo:_bar", "", LinkWiki, "Foo: bar", true},
+		{"anchor", "#Installation", "", LinkAnchor, "Installation", false},
+		{"official package", "https://archlinux.org/packages/core/x86_64/pacman/", "", LinkPackage, "pacman", false},
+		{"package search", "https://archlinux.org/packages/?name=arch-install-scripts", "", LinkPackage, "arch-install-scripts", false},
+		{"aur package", "https://aur.archlinux.org/packages/yay", "", LinkAUR, "yay", false},
+		{"man page", "https://man.archlinux.org/man/ls.1", "", LinkManPage, "ls(1)", false},
+		{"man page with language", "https://man.archlinux.org/man/core/pacman/pacman.conf.5.en", "", LinkManPage, "pacman.conf(5)", false},
+		{"interwiki", "https://en.wikipedia.org/wiki/GNU", "wikipedia:GNU", LinkInterwiki, "wikipedia:GNU", false},
+		{"protocol relative", "//example.com/x", "", LinkExternal, "", false},
+		{"edit link", "/index.php?title=Foo&action=edit&redlink=1", "", LinkOther, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyLink(tt.href, tt.interwikiTitle)
+			if got.Kind != tt.wantKind || got.Target != tt.wantTarget {
+				t.Errorf("classifyLink(%q) = (%q, %q), want (%q, %q)", tt.href, got.Kind, got.Target, tt.wantKind, tt.wantTarget)
+			}
+			if got.crawlable() != tt.wantCrawlable {
+				t.Errorf("classifyLink(%q).crawlable() = %v, want %v", tt.href, got.crawlable(), tt.wantCrawlable)
+			}
+		})
+	}
+}
+
+func TestOutboundLinks(t *testing.T) {
+	doc := parseTestDocument(t, `
+		<p>Install <a href="https://archlinux.org/packages/?name=pacman" class="external text">pacman</a>,
+		see <a href="/title/Pacman">pacman</a>, <a href="/title/Pacman#Usage">usage</a> and <a href="#Tips">tips</a>.
+		Also <a href="https://aur.archlinux.org/packages/yay/">yay</a><sup><small>AUR</small></sup>
+		and <a href="https://man.archlinux.org/man/pacman.8">pacman(8)</a>.</p>`)
+
+	want := []OutboundLink{
+		{Kind: LinkPackage, URL: "https://archlinux.org/packages/?name=pacman", Text: "pacman", Target: "pacman"},
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Pacman", Text: "pacman", Target: "Pacman"},
+		{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Pacman#Usage", Text: "usage", Target: "Pacman"},
+		{Kind: LinkAUR, URL: "https://aur.archlinux.org/packages/yay/", Text: "yay", Target: "yay"},
+		{Kind: LinkManPage, URL: "https://man.archlinux.org/man/pacman.8", Text: "pacman(8)", Target: "pacman(8)"},
+	}
+	if got := doc.OutboundLinks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("OutboundLinks() = %+v, want %+v", got, want)
+	}
+
+	markdown := RenderMarkdown(doc)
+	for _, part := range []string{"[tips](#Tips)", "[`yay`](https://aur.archlinux.org/packages/yay) and"} {
+		if !strings.Contains(markdown, part) {
+			t.Errorf("RenderMarkdown() = %q, want it to contain %q", markdown, part)
+		}
+	}
+}
+
+func TestRenderLinkKinds(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		markdown  string
+		plaintext string
+		html      string
+	}{
+		{
+			name:      "official package",
+			input:     `<a href="https://archlinux.org/packages/core/x86_64/pacman/">pacman</a>`,
+			markdown:  "[`pacman`](https://archlinux.org/packages/?name=pacman)",
+			plaintext: "pacman",
+			html:      `<a href="https://archlinux.org/packages/?name=pacman"><code>pacman</code></a>`,
+		},
+		{
+			name:      "aur package with other text",
+			input:     `<a href="https://aur.archlinux.org/packages/yay/">the yay helper</a>`,
+			markdown:  "[the yay helper](https://aur.archlinux.org/packages/yay)",
+			plaintext: "the yay helper",
+			html:      `<a href="https://aur.archlinux.org/packages/yay">the yay helper</a>`,
+		},
+		{
+			name:      "man page named without section",
+			input:     `<a href="https://man.archlinux.org/man/pacman.8">pacman</a>`,
+			markdown:  "[pacman(8)](https://man.archlinux.org/man/pacman.8)",
+			plaintext: "pacman(8)",
+			html:      `<a href="https://man.archlinux.org/man/pacman.8">pacman(8)</a>`,
+		},
+		{
+			name:      "page that is never scraped",
+			input:     `<a href="/title/Special:Search">search</a>`,
+			markdown:  "[search](https://wiki.archlinux.org/title/Special:Search)",
+			plaintext: "search",
+			html:      `<a href="https://wiki.archlinux.org/title/Special:Search">search</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(t, "<p>"+tt.input+"</p>")
+			if got := RenderMarkdown(doc); got != tt.markdown {
+				t.Errorf("RenderMarkdown() = %q, want %q", got, tt.markdown)
+			}
+			if got := plainBlocks(doc.Blocks); got != tt.plaintext {
+				t.Errorf("plainBlocks() = %q, want %q", got, tt.plaintext)
+			}
+			if got := RenderHTML(doc, "Test"); !strings.Contains(got, "<p>"+tt.html+"</p>") {
+				t.Errorf("RenderHTML() = %q, want it to contain %q", got, tt.html)
+			}
+		})
+	}
+}
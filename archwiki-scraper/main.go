@@ -3,43 +3,124 @@ package main
 import (
 	"flag"
 	"fmt"
+	"html"
 	"log"
-	"net/url"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
-
-	"sync/atomic"
+	"unicode"
 
 	"github.com/gocolly/colly"
-	"github.com/gocolly/colly/queue"
+	"github.com/kyeb/archwiki-scraper/validate"
+	"github.com/kyeb/archwiki-scraper/wikipath"
 )
 
+const userAgent = "Testing scraping tool (+mailto:scraping@kyeb.com)"
+
 var (
-	baseURL    = "https://wiki.archlinux.org"
-	outputDir  string
-	maxDepth   = flag.Int("depth", 100, "maximum crawl depth")
-	concurrent = flag.Int("concurrent", 5, "number of concurrent scrapers")
-	rateLimit  = flag.Duration("rate", 1*time.Second, "time to wait between requests")
-	maxFiles   = flag.Int("max-files", 100, "maximum number of files to scrape")
+	baseURL         = "https://wiki.archlinux.org"
+	outputDir       string
+	maxDepth        = flag.Int("depth", 100, "maximum crawl depth")
+	concurrent      = flag.Int("concurrent", 5, "number of concurrent scrapers")
+	rateLimit       = flag.Duration("rate", 1*time.Second, "time to wait between requests")
+	maxFiles        = flag.Int("max-files", 100, "maximum number of files to scrape")
+	priority        = flag.String("priority", "bfs", "order in which pages of the same depth claim places under max-files: bfs (link order), inlinks (most linked first) or category (most linked from pages sharing a category with a start page first)")
+	downloadMedia   = flag.Bool("download-media", false, "download images into an assets directory shared by all pages in the output directory")
+	outputFormat    = flag.String("format", "markdown", "output format: markdown, plaintext, json or html")
+	tableOfContents = flag.Bool("toc", false, "insert a table of contents at the top of each markdown page")
+	skipRulesFile   = flag.String("skip-rules", "", "JSON file with CSS selectors to exclude from or include in converted pages")
+	diagnostics     = flag.Bool("diagnostics", false, "measure how much page text survives conversion and write "+diagnosticsFile)
+	scopeFile       = flag.String("scope", "", "JSON file with seeds, include and exclude patterns and categories, added to those given as flags")
+	seedFile        = flag.String("seed-file", "", "file with one start page title or URL per line")
+	metricsAddr     = flag.String("metrics-addr", "", "address such as :9090 to serve Prometheus metrics on /metrics and crawl status on /status")
 )
 
-var (
-	visitedURLs    = make(map[string]int)
-	urlMutex       sync.RWMutex
-	uncrawledLinks = make(map[string]string) // map[url]reason
-	uncrawledMutex sync.RWMutex
+// crawlFilter only matches English pages, excluding pages with language
+// codes like (简体中文) or (Español).
+var crawlFilter = regexp.MustCompile(`^https://wiki\.archlinux\.org/title/[^(]+$`)
+
+// listingFilter matches the later pages of category listings, which are
+// fetched along with their category page in category mode.
+var listingFilter = regexp.MustCompile(`^https://wiki\.archlinux\.org/index\.php\?title=Category:`)
+
+// Requests for the later pages of a category listing carry the category page
+// and the position their links are numbered from in their context.
+const (
+	listingContextKey  = "listing_of"
+	listingPositionKey = "listing_position"
 )
 
-var queuedFiles atomic.Int32
+var pageFiles = wikipath.NewManifest()
+
+var subcommands = map[string]func(args []string) error{
+	"convert": func(args []string) error { return runConvert(args, os.Stdin, os.Stdout) },
+	"graph":   func(args []string) error { return runGraph(args, os.Stdout) },
+	"diff":    func(args []string) error { return runDiff(args, os.Stdout) },
+	"sqlite":  runSQLite,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	var scope CrawlScope
 	flag.StringVar(&outputDir, "output", "output", "directory to store markdown files")
+	flag.Var((*stringList)(&scope.Seeds), "seed", "start page title or URL; repeatable (default: Arch Linux)")
+	flag.Var((*stringList)(&scope.Include), "include", "only follow links to pages whose title matches this glob, or regexp prefixed with re:; repeatable")
+	flag.Var((*stringList)(&scope.Exclude), "exclude", "never follow links to pages whose title matches this glob, or regexp prefixed with re:; repeatable")
+	flag.Var((*stringList)(&scope.Categories), "category", "crawl the pages of this category and its subcategories instead of following every link; repeatable")
 	flag.Parse()
 
+	if _, ok := outputFormats[*outputFormat]; !ok {
+		log.Fatalf("Unknown output format %q", *outputFormat)
+	}
+	priorityFunc, ok := priorityFuncs[*priority]
+	if !ok {
+		log.Fatalf("Unknown priority %q", *priority)
+	}
+
+	if *skipRulesFile != "" {
+		rules, err := loadSkipRules(*skipRulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		activeSkipRules = rules
+	}
+
+	if *scopeFile != "" {
+		fileScope, err := loadCrawlScope(*scopeFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scope.Seeds = append(scope.Seeds, fileScope.Seeds...)
+		scope.Include = append(scope.Include, fileScope.Include...)
+		scope.Exclude = append(scope.Exclude, fileScope.Exclude...)
+		scope.Categories = append(scope.Categories, fileScope.Categories...)
+	}
+	if *seedFile != "" {
+		seeds, err := readSeedFile(*seedFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scope.Seeds = append(scope.Seeds, seeds...)
+	}
+	if len(scope.Seeds) == 0 && len(scope.Categories) == 0 {
+		scope.Seeds = []string{"Arch_Linux"}
+	}
+	matcher, err := compileCrawlScope(scope)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Printf("Starting scraper with depth=%d, concurrent=%d, rate=%v, output=%s",
 		*maxDepth, *concurrent, *rateLimit, outputDir)
 
@@ -52,212 +133,370 @@ func main() {
 
 	c := colly.NewCollector(
 		colly.AllowedDomains("wiki.archlinux.org"),
-		colly.URLFilters(
-			// Only match English pages - exclude pages with language codes like (简体中文) or (Español)
-			regexp.MustCompile(`^https://wiki\.archlinux\.org/title/[^(]+$`),
-		),
-		colly.UserAgent("Testing scraping tool (+mailto:scraping@kyeb.com)"),
+		colly.URLFilters(crawlFilter, listingFilter),
+		colly.UserAgent(userAgent),
+		colly.Async(true),
 	)
+	c.WithTransport(timedTransport{http.DefaultTransport})
 
-	q, _ := queue.New(
-		*concurrent,
-		&queue.InMemoryQueueStorage{MaxSize: 10000},
-	)
+	scheduler := NewScheduler(*maxDepth, *maxFiles, priorityFunc)
+	scheduler.OnSkip = func(c *Candidate, reason string) {
+		recordUncrawled(c.URL, c.Parent, reason)
+	}
 
 	c.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
 		Parallelism: *concurrent,
 		RandomDelay: *rateLimit,
 	})
+	// Images are fetched through the crawl's collector so they count against
+	// its rate limit.
+	mediaCollector = newMediaCollector(c)
+
+	// followLinks discovers the crawlable links selected on a page as links of
+	// pageURL, numbered from position, and returns the position after the last
+	// of them. The later pages of a category listing are fetched within the
+	// same depth and their links numbered after the page's own, so a category
+	// has the same members however many pages list them.
+	followLinks := func(e *colly.HTMLElement, pageURL, selector string, position int) int {
+		var listings []string
+		e.ForEach(selector, func(_ int, el *colly.HTMLElement) {
+			href := el.Attr("href")
+			if next, ok := matcher.listingContinuation(href); ok {
+				listings = append(listings, next)
+				return
+			}
+			link := classifyLink(href, "")
+			if link.Kind != LinkWiki && link.Kind != LinkNamespace {
+				return
+			}
+			// Ignore anchor; they're just links to subheaders within a page
+			fullURL := strings.Split(baseURL+href, "#")[0]
+			switch {
+			case !link.crawlable():
+				recordUncrawled(fullURL, pageURL, skipNamespace)
+			case !crawlFilter.MatchString(fullURL):
+				recordUncrawled(fullURL, pageURL, skipLanguage)
+			case !matcher.allows(fullURL):
+				recordUncrawled(fullURL, pageURL, skipFiltered)
+			default:
+				scheduler.Discover(pageURL, position, fullURL)
+				position++
+			}
+		})
+		for _, next := range listings {
+			ctx := colly.NewContext()
+			ctx.Put(listingContextKey, pageURL)
+			ctx.Put(listingPositionKey, position)
+			if err := c.Request("GET", next, nil, ctx, nil); err != nil && err != colly.ErrAlreadyVisited {
+				log.Printf("Error visiting %s: %v", next, err)
+			}
+		}
+		return position
+	}
 
 	c.OnRequest(func(r *colly.Request) {
 		log.Printf("Visiting %s", r.URL)
 	})
 
+	c.OnResponse(func(r *colly.Response) {
+		r.Ctx.Put("fetched_at", time.Now())
+		markFetched(r.Request.URL.String())
+		pageURL := r.Request.URL.String()
+		if category, ok := listingOf(r.Ctx); ok {
+			pageURL = category
+		}
+		depth, _, _ := scheduler.Page(pageURL)
+		stats.fetched(depth, len(r.Body))
+	})
+
 	c.OnHTML("div#mw-content-text", func(e *colly.HTMLElement) {
+		start := time.Now()
+		defer func() { stats.converted(time.Since(start)) }()
+
 		pageURL := e.Request.URL.String()
 		log.Printf("Processing content from %s", pageURL)
 
 		// Strip anchor from URL
 		pageURL = strings.Split(pageURL, "#")[0]
 
+		if category, ok := listingOf(e.Request.Ctx); ok {
+			position, _ := e.Request.Ctx.GetAny(listingPositionKey).(int)
+			depth, _, _ := scheduler.Page(category)
+			if selector := matcher.linkSelector(category); selector != "" {
+				found := followLinks(e, category, selector, position) - position
+				log.Printf("Found %d links on %s (depth %d)", found, pageURL, depth)
+			}
+			return
+		}
+
 		title := e.DOM.Parent().Find("h1#firstHeading").Text()
 		if title == "" {
 			title = strings.TrimPrefix(e.Request.URL.Path, "/title/")
 			title = strings.ReplaceAll(title, "_", " ")
 		}
 
-		markdown := ConvertToMarkdown(e.DOM)
-		if markdown == "" {
+		doc := ParseDocument(e.DOM)
+		if doc == nil || doc.isEmpty() {
 			log.Printf("Warning: No content extracted from %s", pageURL)
+			depth, _, _ := scheduler.Page(pageURL)
+			stats.skippedEmpty(depth)
 			return
 		}
 
-		filename := urlToFilename(pageURL)
-		log.Printf("Saving to %s", filename)
-		if err := savePage(filename, markdown, pageURL, title); err != nil {
-			log.Printf("Error saving %s: %v", filename, err)
+		if *diagnostics {
+			d := diagnoseConversion(e.DOM, pageURL, RenderMarkdown(doc))
+			log.Printf("Conversion coverage for %s: %.1f%% (%d of %d words missing)",
+				pageURL, d.Coverage*100, d.MissingWords, d.SourceWords)
+			recordDiagnostics(d)
+		}
+
+		requestURL := pageURL
+		meta := extractPageMeta(documentRoot(e.DOM), pageURL)
+		canonical := wikiPathFromURL(meta.CanonicalURL)
+		if requested := wikiPathFromURL(pageURL); canonical != "" && requested != "" && canonical != requested {
+			log.Printf("%s redirects to %s", pageURL, meta.CanonicalURL)
+			recordRedirect(requested, canonical)
+			pageURL = meta.CanonicalURL
 		}
 
-		urlMutex.RLock()
-		currentDepth := visitedURLs[pageURL]
-		urlMutex.RUnlock()
-
-		if currentDepth < *maxDepth {
-			linkCount := 0
-			addedLinkCount := 0
-			hitMaxFiles := false
-			e.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
-				href := el.Attr("href")
-				if strings.HasPrefix(href, "/title/") && !strings.Contains(href, ":") {
-					fullURL := baseURL + href
-
-					// Ignore anchor; they're just links to subheaders within a page
-					fullURL = strings.Split(fullURL, "#")[0]
-
-					linkCount++
-
-					urlMutex.RLock()
-					_, exists := visitedURLs[fullURL]
-					urlMutex.RUnlock()
-
-					if !exists {
-						queuedFiles.Add(1)
-						if queuedFiles.Load() >= int32(*maxFiles) || currentDepth >= *maxDepth {
-							reason := "max_files_limit"
-							if currentDepth >= *maxDepth {
-								reason = "max_depth"
-							}
-							uncrawledMutex.Lock()
-							uncrawledLinks[fullURL] = reason
-							uncrawledMutex.Unlock()
-
-							if queuedFiles.Load() >= int32(*maxFiles) {
-								hitMaxFiles = true
-								return
-							}
-						} else {
-							urlMutex.Lock()
-							visitedURLs[fullURL] = currentDepth + 1
-							urlMutex.Unlock()
-
-							q.AddURL(fullURL)
-							addedLinkCount++
-						}
-					}
-				}
-			})
-			if hitMaxFiles {
-				log.Printf("Reached max files limit (%d), queued %d links out of %d", *maxFiles, addedLinkCount, linkCount)
+		scheduler.Alias(requestURL, pageURL)
+		markFetched(pageURL)
+		scheduler.SetCategories(pageURL, meta.Categories)
+		currentDepth, parent, _ := scheduler.Page(requestURL)
+
+		filename := urlToFilename(pageURL)
+		fetchedAt, _ := e.Request.Ctx.GetAny("fetched_at").(time.Time)
+		record := PageRecord{
+			URL:       pageURL,
+			File:      filepath.Base(filename),
+			Title:     title,
+			Depth:     currentDepth,
+			Status:    e.Response.StatusCode,
+			ParentURL: parent,
+			FetchedAt: fetchedAt,
+		}
+		// Every URL leading to the page is recorded and has its links
+		// discovered, so the manifest and the next depth do not depend on
+		// which response was processed first. Only the first is saved.
+		if claimPage(wikiPathFromURL(pageURL), filename) {
+			log.Printf("Saving to %s", filename)
+			meta.Title = title
+			meta.URL = pageURL
+			meta.Aliases = pageAliases(wikiPathFromURL(pageURL))
+			if err := savePage(filename, doc, meta); err != nil {
+				log.Printf("Error saving %s: %v", filename, err)
 			} else {
-				log.Printf("Queued %d links from %s (depth %d)", addedLinkCount, pageURL, currentDepth)
+				stats.saved(currentDepth)
+				recordPage(record, scheduler.Rank(requestURL))
+				recordLinks(pageURL, doc.OutboundLinks())
 			}
 		} else {
-			log.Printf("Reached max depth (%d) for %s, not queuing more links", *maxDepth, pageURL)
+			log.Printf("Not saving %s again: already saved as %s", requestURL, filename)
+			stats.duplicate()
+			recordPage(record, scheduler.Rank(requestURL))
+		}
+
+		if selector := matcher.linkSelector(requestURL); selector != "" {
+			linkCount := followLinks(e, pageURL, selector, 0)
+			log.Printf("Found %d links on %s (depth %d)", linkCount, pageURL, currentDepth)
 		}
 	})
 
 	c.OnError(func(r *colly.Response, err error) {
 		log.Printf("Error scraping %s: %v", r.Request.URL, err)
+		category, listing := listingOf(r.Ctx)
+		_, parent, _ := scheduler.Page(r.Request.URL.String())
+		if listing {
+			parent = category
+		}
+		recordUncrawled(r.Request.URL.String(), parent, skipError)
+		stats.errored(r.StatusCode)
+		if !listing {
+			stats.done()
+		}
 	})
 
-	startURL := baseURL + "/title/Arch_Linux"
-	log.Printf("Starting with URL: %s", startURL)
-	urlMutex.Lock()
-	visitedURLs[startURL] = 0
-	urlMutex.Unlock()
-	q.AddURL(startURL)
+	c.OnScraped(func(r *colly.Response) {
+		if _, listing := listingOf(r.Ctx); !listing {
+			stats.done()
+		}
+	})
+
+	seeds := scope.seedURLs()
+	log.Printf("Starting with URLs: %s", strings.Join(seeds, ", "))
+	scheduler.Seed(seeds...)
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr, stats)
+	}
+
+	for batch := scheduler.Next(); len(batch) > 0; batch = scheduler.Next() {
+		log.Printf("Fetching %d pages at depth %d", len(batch), scheduler.Depth())
+		stats.startDepth(scheduler.Depth(), len(batch))
+		for _, pageURL := range batch {
+			if err := c.Visit(pageURL); err != nil {
+				log.Printf("Error visiting %s: %v", pageURL, err)
+				stats.done()
+			}
+		}
+		c.Wait()
+	}
+
+	if err := settlePageFiles(); err != nil {
+		log.Printf("Error renaming colliding files: %v", err)
+	}
+	if *outputFormat == "markdown" {
+		if err := finalizeLinks(); err != nil {
+			log.Printf("Error updating links: %v", err)
+		}
+	}
+	if err := pageFiles.WriteFile(filepath.Join(outputDir, wikipath.TitlesFile), formatExtension(*outputFormat)); err != nil {
+		log.Printf("Error writing %s: %v", wikipath.TitlesFile, err)
+	}
+
+	if err := writeManifest(outputDir); err != nil {
+		log.Printf("Error writing %s: %v", validate.ManifestFile, err)
+	}
 
-	log.Printf("Starting queue processing")
-	q.Run(c)
+	if err := writeLinkGraph(outputDir); err != nil {
+		log.Printf("Error writing %s: %v", linkGraphFile, err)
+	}
 
-	if err := writeUncrawledLinks(); err != nil {
+	if err := writeUncrawledLinks(outputDir); err != nil {
 		log.Printf("Error writing uncrawled links: %v", err)
 	}
 
+	if *diagnostics {
+		if err := writeDiagnosticsReport(filepath.Join(outputDir, diagnosticsFile)); err != nil {
+			log.Printf("Error writing conversion report: %v", err)
+		}
+	}
+
+	report := stats.snapshot()
+	report.Seeds = seeds
+	report.Config = flagConfig(flag.CommandLine)
+	report.Config["include"] = strings.Join(scope.Include, ",")
+	report.Config["exclude"] = strings.Join(scope.Exclude, ",")
+	report.Config["category"] = strings.Join(scope.Categories, ",")
+	delete(report.Config, "seed")
+	if err := writeRunReport(outputDir, report); err != nil {
+		log.Printf("Error writing %s: %v", runReportFile, err)
+	}
+	writeRunSummary(os.Stdout, report)
+
 	fmt.Println("Scraping completed!")
 }
 
+// listingOf returns the category page whose listing a request continues, if
+// it is for a later page of one.
+func listingOf(ctx *colly.Context) (string, bool) {
+	category, ok := ctx.GetAny(listingContextKey).(string)
+	return category, ok
+}
+
 func urlToFilename(pageURL string) string {
-	u, err := url.Parse(pageURL)
-	if err != nil {
-		return "unknown.md"
+	title := wikiPathFromURL(pageURL)
+	if title == "" {
+		return filepath.Join(outputDir, "unknown"+formatExtension(*outputFormat))
 	}
+	return filepath.Join(outputDir, pageFiles.Assign(title)+formatExtension(*outputFormat))
+}
 
-	path := strings.TrimPrefix(u.Path, "/title/")
-	return filepath.Join(outputDir, path+".md")
+func convertWikiLinks(content string) string {
+	return mapHTMLLinks(mapLinkTargets(content, wikiLinkTarget), wikiLinkTarget)
 }
 
-func convertWikiLinks(content, currentFile string) string {
-	re := regexp.MustCompile(`\[([^\]]+)\]\(/title/([^#\)]+)(?:#([^\)]+))?\)`)
+// wikiLinkTarget returns the file a /title/ link points at, keeping its
+// anchor, and leaves other targets alone.
+func wikiLinkTarget(target string) string {
+	wikiPath, ok := strings.CutPrefix(target, "/title/")
+	if !ok {
+		return target
+	}
+	wikiPath, anchor, found := strings.Cut(wikiPath, "#")
+	if found {
+		anchor = "#" + anchor
+	}
+	if wikiPath == "" {
+		return target
+	}
+	return wikiLinkPath(resolveRedirect(wikiPath)) + anchor
+}
 
-	return re.ReplaceAllStringFunc(content, func(match string) string {
-		submatches := re.FindStringSubmatch(match)
-		if len(submatches) < 3 {
-			return match
+// htmlLinkPattern matches the href attributes of the HTML kept in markdown
+// for tables it cannot express.
+var htmlLinkPattern = regexp.MustCompile(`href="([^"]*)"`)
+
+// mapHTMLLinks replaces every href attribute in content with fn's result.
+func mapHTMLLinks(content string, fn func(target string) string) string {
+	return htmlLinkPattern.ReplaceAllStringFunc(content, func(attr string) string {
+		target := html.UnescapeString(htmlLinkPattern.FindStringSubmatch(attr)[1])
+		mapped := fn(target)
+		if mapped == target {
+			return attr
 		}
+		return `href="` + html.EscapeString(mapped) + `"`
+	})
+}
 
-		linkText := submatches[1]
-		wikiPath := submatches[2]
-		anchor := ""
-		if len(submatches) > 3 && submatches[3] != "" {
-			anchor = "#" + submatches[3]
+// mapLinkTargets replaces the destination of every inline markdown link in
+// content with fn's result. Destinations end at whitespace or at the closing
+// parenthesis, so titles such as "Installation guide (Español)" stay whole.
+func mapLinkTargets(content string, fn func(target string) string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(content, "](")
+		if i < 0 {
+			break
 		}
-
-		// Get the relative path from current file to target file
-		currentDir := filepath.Dir(strings.TrimPrefix(currentFile, outputDir+"/"))
-		targetPath := wikiPath
-
-		// Calculate relative path
-		var relPath string
-		if currentDir == "." {
-			relPath = targetPath + ".md"
-		} else {
-			// Count directory levels and add appropriate ../
-			depth := len(strings.Split(currentDir, "/"))
-			prefix := strings.Repeat("../", depth-1)
-			relPath = prefix + targetPath + ".md"
+		b.WriteString(content[:i+2])
+		content = content[i+2:]
+
+		end, depth := -1, 0
+	scan:
+		for j, r := range content {
+			switch {
+			case r == '(':
+				depth++
+			case r == ')' && depth == 0:
+				end = j
+				break scan
+			case r == ')':
+				depth--
+			case unicode.IsSpace(r):
+				break scan
+			}
+		}
+		if end > 0 {
+			b.WriteString(fn(content[:end]))
+			content = content[end:]
 		}
+	}
+	b.WriteString(content)
+	return b.String()
+}
 
-		return fmt.Sprintf("[%s](%s%s)", linkText, relPath, anchor)
-	})
+// wikiLinkPath returns the path of the markdown file for wikiPath relative to
+// any other page, as all pages are saved directly in the output directory.
+func wikiLinkPath(wikiPath string) string {
+	return pageFiles.Name(wikiPath) + ".md"
 }
 
-func savePage(filename, content, pageURL, title string) error {
+func savePage(filename string, doc *Document, meta PageMeta) error {
 	dir := filepath.Dir(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	content = convertWikiLinks(content, filename)
-
-	content = fmt.Sprintf("---\ntitle: %s\nurl: %s\ndate_scraped: %s\n---\n\n%s",
-		title,
-		pageURL,
-		time.Now().Format(time.RFC3339),
-		content)
-
-	return os.WriteFile(filename, []byte(content), 0644)
-}
-
-func writeUncrawledLinks() error {
-	uncrawledMutex.RLock()
-	defer uncrawledMutex.RUnlock()
-
-	if len(uncrawledLinks) == 0 {
-		return nil
-	}
-
-	f, err := os.Create(filepath.Join(outputDir, "uncrawled_links.txt"))
+	meta.DateScraped = time.Now().Truncate(time.Second)
+	content, err := renderPage(*outputFormat, doc, filename, meta)
 	if err != nil {
-		return fmt.Errorf("failed to create uncrawled links file: %v", err)
+		return err
 	}
-	defer f.Close()
 
-	for url, reason := range uncrawledLinks {
-		if _, err := fmt.Fprintf(f, "%s\t%s\n", url, reason); err != nil {
-			return fmt.Errorf("failed to write uncrawled link: %v", err)
-		}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		return err
 	}
+	stats.wrote(len(content))
 	return nil
 }
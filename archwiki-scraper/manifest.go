@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+// PageRecord is one line of the crawl manifest. File is relative to the output
+// directory; Bytes and ContentHash describe the file as finally written.
+type PageRecord struct {
+	URL         string    `json:"url"`
+	File        string    `json:"file"`
+	Title       string    `json:"title"`
+	Depth       int       `json:"depth"`
+	Status      int       `json:"status"`
+	Bytes       int64     `json:"bytes"`
+	ContentHash string    `json:"content_hash"`
+	ParentURL   string    `json:"parent_url,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+var (
+	pageRecords  = make(map[string]PageRecord) // map[url]record
+	recordRanks  = make(map[string][2]int)     // map[url]scheduler rank of the record
+	recordsMutex sync.Mutex
+)
+
+// recordPage records a fetched page. A page reached through several URLs keeps
+// the record of the URL the scheduler ranked first, whichever response was
+// processed first.
+func recordPage(record PageRecord, rank [2]int) {
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+	if current, ok := recordRanks[record.URL]; ok && !orderLess(rank, current) {
+		return
+	}
+	pageRecords[record.URL] = record
+	recordRanks[record.URL] = rank
+}
+
+// writeManifest writes one JSON record per saved page, sorted by URL. Sizes
+// and hashes are read back from disk because pages can be rewritten after
+// they are first saved.
+func writeManifest(dir string) error {
+	recordsMutex.Lock()
+	records := make([]PageRecord, 0, len(pageRecords))
+	for _, record := range pageRecords {
+		records = append(records, record)
+	}
+	recordsMutex.Unlock()
+	return writeManifestRecords(dir, records)
+}
+
+// writeManifestRecords writes records to the manifest in dir, refreshing their
+// sizes and hashes from the files on disk.
+func writeManifestRecords(dir string, records []PageRecord) error {
+	records = append([]PageRecord(nil), records...)
+	sort.Slice(records, func(i, j int) bool { return records[i].URL < records[j].URL })
+
+	f, err := os.Create(filepath.Join(dir, validate.ManifestFile))
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %v", err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, record := range records {
+		data, err := os.ReadFile(filepath.Join(dir, record.File))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", record.File, err)
+		}
+		record.Bytes = int64(len(data))
+		record.ContentHash = contentHash(string(data))
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write manifest record: %v", err)
+		}
+	}
+	return f.Close()
+}
+
+func readManifest(dir string) ([]PageRecord, error) {
+	return readManifestFile(filepath.Join(dir, validate.ManifestFile))
+}
+
+func readManifestFile(filename string) ([]PageRecord, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []PageRecord
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var record PageRecord
+		if err := dec.Decode(&record); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+func TestWriteManifest(t *testing.T) {
+	defer func(records map[string]PageRecord, ranks map[string][2]int) {
+		pageRecords, recordRanks = records, ranks
+	}(pageRecords, recordRanks)
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"Pacman.md": "pacman page", "Arch_Linux.md": "arch"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetched := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	pageRecords, recordRanks = make(map[string]PageRecord), make(map[string][2]int)
+	// Pacman is reached through two URLs at depth 1; the record of the one
+	// ranked first is kept although it arrives last.
+	recordPage(PageRecord{URL: "https://wiki.archlinux.org/title/Pacman", File: "Pacman.md", Title: "Pacman", Depth: 1, Status: 200, ParentURL: "https://wiki.archlinux.org/title/Pacman_(alias)", FetchedAt: fetched}, [2]int{1, 4})
+	recordPage(PageRecord{URL: "https://wiki.archlinux.org/title/Pacman", File: "Pacman.md", Title: "Pacman", Depth: 1, Status: 200, ParentURL: "https://wiki.archlinux.org/title/Arch_Linux", FetchedAt: fetched}, [2]int{1, 2})
+	recordPage(PageRecord{URL: "https://wiki.archlinux.org/title/Pacman", File: "Pacman.md", Title: "Pacman", Depth: 1, Status: 200, ParentURL: "https://wiki.archlinux.org/title/Other", FetchedAt: fetched}, [2]int{1, 3})
+	recordPage(PageRecord{URL: "https://wiki.archlinux.org/title/Arch_Linux", File: "Arch_Linux.md", Title: "Arch Linux", Status: 200, FetchedAt: fetched}, [2]int{0, 0})
+
+	if err := writeManifest(dir); err != nil {
+		t.Fatalf("writeManifest() error = %v", err)
+	}
+
+	got, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest() error = %v", err)
+	}
+
+	want := []PageRecord{
+		{URL: "https://wiki.archlinux.org/title/Arch_Linux", File: "Arch_Linux.md", Title: "Arch Linux", Status: 200, Bytes: 4, ContentHash: contentHash("arch"), FetchedAt: fetched},
+		{URL: "https://wiki.archlinux.org/title/Pacman", File: "Pacman.md", Title: "Pacman", Depth: 1, Status: 200, Bytes: 11, ContentHash: contentHash("pacman page"), ParentURL: "https://wiki.archlinux.org/title/Arch_Linux", FetchedAt: fetched},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest = %+v, want %+v", got, want)
+	}
+}
+
+func TestValidateLinksFromManifest(t *testing.T) {
+	dir := t.TempDir()
+	pages := map[string]string{
+		"Listed.md":   "[missing](Missing.md)",
+		"Unlisted.md": "[also missing](Other.md)",
+	}
+	for name, content := range pages {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := `{"url":"https://wiki.archlinux.org/title/Listed","file":"Listed.md"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, validate.ManifestFile), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errors := validate.ValidateLinks(dir)
+	if len(errors) != 1 {
+		t.Fatalf("ValidateLinks() = %v, want one error for the listed page only", errors)
+	}
+}
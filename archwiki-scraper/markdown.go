@@ -2,266 +2,379 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 func ConvertToMarkdown(s *goquery.Selection) string {
-	var result strings.Builder
+	doc := ParseDocument(s)
+	if doc == nil {
+		return ""
+	}
+	return RenderMarkdown(doc)
+}
 
-	title := s.Find("h1#firstHeading").Text()
-	if title != "" {
-		result.WriteString("# " + strings.TrimSpace(title) + "\n\n")
+func RenderMarkdown(doc *Document) string {
+	var parts []string
+	if doc.Title != "" {
+		parts = append(parts, "# "+doc.Title)
+	}
+	if blocks := renderBlocks(doc.Blocks); blocks != "" {
+		parts = append(parts, blocks)
+	}
+	for _, section := range doc.Sections {
+		parts = append(parts, renderSection(section))
+	}
+	if footnotes := renderFootnotes(doc.Footnotes); footnotes != "" {
+		parts = append(parts, footnotes)
 	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
 
-	content := s.Find("div.mw-parser-output")
-	if content.Length() == 0 {
-		return ""
+func renderSection(s *Section) string {
+	parts := []string{renderHeading(s)}
+	if blocks := renderBlocks(s.Blocks); blocks != "" {
+		parts = append(parts, blocks)
+	}
+	for _, sub := range s.Sections {
+		parts = append(parts, renderSection(sub))
 	}
+	return strings.Join(parts, "\n\n")
+}
 
-	content.Children().Each(func(i int, s *goquery.Selection) {
-		if shouldSkipElement(s) {
-			return
-		}
+func renderHeading(s *Section) string {
+	heading := strings.Repeat("#", s.Level) + " " + s.Title
+	if s.Anchor != "" {
+		heading = fmt.Sprintf("<a id=\"%s\"></a>\n\n%s", html.EscapeString(s.Anchor), heading)
+	}
+	return heading
+}
 
-		if heading := processHeading(s); heading != "" {
-			result.WriteString(heading + "\n\n")
-			return
+func renderBlocks(blocks []Block) string {
+	var parts []string
+	for _, block := range blocks {
+		if text := renderBlock(block); text != "" {
+			parts = append(parts, text)
 		}
+	}
+	return strings.Join(parts, "\n\n")
+}
 
-		if para := processParagraph(s); para != "" {
-			result.WriteString(para + "\n\n")
-			return
+func renderBlock(block Block) string {
+	switch b := block.(type) {
+	case Paragraph:
+		return strings.TrimSpace(renderInlines(b.Inlines))
+	case List:
+		return renderList(b)
+	case DefinitionList:
+		return renderDefinitionList(b)
+	case Table:
+		if tableHasBlockContent(b) {
+			return renderKeyValueTable(b)
 		}
-
-		if list := processList(s); list != "" {
-			result.WriteString(list + "\n\n")
-			return
+		return renderGFMTable(b)
+	case CodeBlock:
+		return renderCodeBlock(b)
+	case Admonition:
+		kind := strings.ToUpper(b.Kind[:1]) + b.Kind[1:]
+		return prefixLines("**"+kind+":** "+renderBlocks(b.Blocks), "> ")
+	case Quote:
+		return prefixLines(renderBlocks(b.Blocks), "> ")
+	case Figure:
+		image := renderInline(b.Image)
+		caption := strings.TrimSpace(renderInlines(b.Caption))
+		if caption == "" {
+			return image
 		}
+		return image + "\n\n_" + caption + "_"
+	case RawHTML:
+		return sanitizeHTMLLinks(b.HTML, markdownHref)
+	}
+	return ""
+}
 
-		if code := processCodeBlock(s); code != "" {
-			result.WriteString(code + "\n\n")
-			return
-		}
+// markdownHref keeps links to wiki pages in raw HTML relative, like those of
+// markdown links, so convertWikiLinks points them at the saved files.
+func markdownHref(href string) string {
+	if strings.HasPrefix(href, "/title/") {
+		return href
+	}
+	return webHref(href)
+}
 
-		if table := processTable(s); table != "" {
-			result.WriteString(table + "\n\n")
-			return
+func renderList(l List) string {
+	var items []string
+	for i, item := range l.Items {
+		prefix := "* "
+		if l.Ordered {
+			prefix = fmt.Sprintf("%d. ", i+1)
 		}
-
-		if s.Is("div") && !shouldSkipElement(s) {
-			s.Children().Each(func(i int, s *goquery.Selection) {
-				if para := processParagraph(s); para != "" {
-					result.WriteString(para + "\n\n")
-				}
-			})
+		body := renderListItem(item)
+		if body == "" {
+			continue
 		}
-	})
-
-	return strings.TrimSpace(result.String())
+		pad := strings.Repeat(" ", len(prefix))
+		items = append(items, prefix+strings.TrimPrefix(indentLines(body, pad), pad))
+	}
+	return strings.Join(items, "\n")
 }
 
-func shouldSkipElement(s *goquery.Selection) bool {
-	if s.HasClass("mw-jump-link") || s.HasClass("mw-editsection") || 
-	   s.HasClass("vector-toc") || s.HasClass("mw-indicators") ||
-	   s.HasClass("catlinks") || s.HasClass("printfooter") ||
-	   s.HasClass("noprint") || s.HasClass("mw-empty-elt") ||
-	   s.HasClass("mw-editsection-bracket") {
-		return true
-	}
-	
-	if id, exists := s.Attr("id"); exists {
-		skippedIDs := []string{
-			"mw-navigation",
-			"mw-head",
-			"siteNotice",
-			"archnavbar",
-			"footer",
-			"mw-page-tools",
-			"mw-site-navigation",
-			"toc",
+func renderListItem(item ListItem) string {
+	var result strings.Builder
+	for _, block := range item.Blocks {
+		text := renderBlock(block)
+		if text == "" {
+			continue
 		}
-		for _, skip := range skippedIDs {
-			if id == skip {
-				return true
+		if result.Len() > 0 {
+			switch block.(type) {
+			case List, CodeBlock:
+				result.WriteString("\n")
+			default:
+				result.WriteString("\n\n")
 			}
 		}
+		result.WriteString(text)
 	}
-	
-	return false
+	return result.String()
 }
 
-func processHeading(s *goquery.Selection) string {
-	for i := 1; i <= 6; i++ {
-		if s.Is(fmt.Sprintf("h%d", i)) {
-			text := strings.TrimSpace(s.Text())
-			if idx := strings.Index(text, "[edit]"); idx != -1 {
-				text = strings.TrimSpace(text[:idx])
-			}
-			if text == "" {
-				return ""
+func renderDefinitionList(dl DefinitionList) string {
+	var result strings.Builder
+	previousTerm := false
+	for _, item := range dl.Items {
+		body := renderBlocks(item.Blocks)
+		term := strings.TrimSpace(renderInlines(item.Term))
+
+		var text string
+		switch {
+		case term == "":
+			text = body
+		case body == "":
+			text = "* **" + term + "**"
+		case !strings.Contains(body, "\n"):
+			text = "* **" + term + "**: " + body
+		default:
+			text = "* **" + term + "**\n" + indentLines(body, "  ")
+		}
+		if text == "" {
+			continue
+		}
+
+		if result.Len() > 0 {
+			if previousTerm && term != "" {
+				result.WriteString("\n")
+			} else {
+				result.WriteString("\n\n")
 			}
-			return strings.Repeat("#", i) + " " + text
 		}
+		result.WriteString(text)
+		previousTerm = term != ""
 	}
-	return ""
+	return result.String()
 }
 
-func processParagraph(s *goquery.Selection) string {
-	if !s.Is("p") {
-		return ""
+func renderCodeBlock(code CodeBlock) string {
+	info := code.Language
+	if code.Caption != "" {
+		if info == "" {
+			info = "text"
+		}
+		info += fmt.Sprintf(" title=%q", code.Caption)
+	}
+	fence := codeFence(code.Code)
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, info, code.Code, fence)
+}
+
+// codeFence returns a backtick fence longer than any backtick run in code, so
+// code documenting markdown cannot close the block early.
+func codeFence(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
 	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func renderGFMTable(table Table) string {
+	width := len(table.Rows[0])
 
 	var result strings.Builder
-	s.Contents().Each(func(i int, s *goquery.Selection) {
-		if s.Is("a") {
-			href, exists := s.Attr("href")
-			if exists {
-				text := strings.TrimSpace(s.Text())
-				if text == "" {
-					return
-				}
-				if strings.HasPrefix(href, "/title/") {
-					result.WriteString(fmt.Sprintf("[%s](%s)", text, href))
-				} else if strings.HasPrefix(href, "http") {
-					result.WriteString(fmt.Sprintf("[%s](%s)", text, href))
-				} else {
-					result.WriteString(text)
-				}
-			} else {
-				result.WriteString(s.Text())
+	result.WriteString(gfmRow(tableHeaders(table)))
+	result.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+
+	for _, row := range table.Rows[table.HeaderRows:] {
+		cells := make([]string, width)
+		for j, cell := range row {
+			cells[j] = cellMarkdown(cell)
+			if cells[j] != "" && cell.Header {
+				cells[j] = "**" + cells[j] + "**"
 			}
-			return
 		}
-		if s.Is("code") {
-			result.WriteString(fmt.Sprintf("`%s`", s.Text()))
-			return
-		}
-		if s.Is("i") || s.Is("em") {
-			result.WriteString(fmt.Sprintf("_%s_", s.Text()))
-			return
-		}
-		if s.Is("b") || s.Is("strong") {
-			result.WriteString(fmt.Sprintf("**%s**", s.Text()))
-			return
-		}
-		if goquery.NodeName(s) == "#text" {
-			result.WriteString(s.Text())
+		result.WriteString(gfmRow(cells))
+	}
+
+	return strings.TrimSpace(result.String())
+}
+
+func tableHeaders(table Table) []string {
+	width := len(table.Rows[0])
+	headers := make([]string, width)
+	for j := 0; j < width; j++ {
+		var parts []string
+		for _, row := range table.Rows[:table.HeaderRows] {
+			text := cellMarkdown(row[j])
+			if text != "" && (len(parts) == 0 || parts[len(parts)-1] != text) {
+				parts = append(parts, text)
+			}
 		}
-	})
+		headers[j] = strings.Join(parts, " / ")
+	}
+	return headers
+}
 
-	text := strings.TrimSpace(result.String())
-	if text == "" {
+func cellMarkdown(cell *TableCell) string {
+	if cell == nil {
 		return ""
 	}
-	return text
+
+	var lines []string
+	for _, block := range cell.Blocks {
+		if text := renderBlock(block); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
 }
 
-func processList(s *goquery.Selection) string {
-	if !s.Is("ul, ol") {
-		return ""
+func gfmRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = escapeTableCell(cell)
 	}
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
+
+func escapeTableCell(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
+
+func renderKeyValueTable(table Table) string {
+	headers := tableHeaders(table)
 
 	var result strings.Builder
-	s.Find("li").Each(func(i int, s *goquery.Selection) {
-		prefix := "* "
-		if s.Parent().Is("ol") {
-			prefix = fmt.Sprintf("%d. ", i+1)
+	for _, row := range table.Rows[table.HeaderRows:] {
+		label := cellMarkdown(row[0])
+		if label == "" {
+			label = headers[0]
 		}
-		
-		var itemText strings.Builder
-		s.Contents().Each(func(i int, s *goquery.Selection) {
-			if s.Is("a") {
-				href, exists := s.Attr("href")
-				if exists && strings.HasPrefix(href, "/title/") {
-					itemText.WriteString(fmt.Sprintf("[%s](%s)", s.Text(), href))
-					return
-				}
-			}
-			if s.Is("code") {
-				itemText.WriteString(fmt.Sprintf("`%s`", s.Text()))
-				return
+		result.WriteString("* **" + strings.ReplaceAll(label, "\n", " ") + "**\n")
+
+		for j := 1; j < len(row); j++ {
+			if row[j] == nil || row[j] == row[j-1] {
+				continue
 			}
-			if s.Is("i") || s.Is("em") {
-				itemText.WriteString(fmt.Sprintf("_%s_", s.Text()))
-				return
+			value := renderBlocks(row[j].Blocks)
+			if value == "" {
+				continue
 			}
-			if s.Is("b") || s.Is("strong") {
-				itemText.WriteString(fmt.Sprintf("**%s**", s.Text()))
-				return
+			key := ""
+			if headers[j] != "" {
+				key = "**" + headers[j] + "**: "
 			}
-			if goquery.NodeName(s) == "#text" {
-				itemText.WriteString(s.Text())
+			if !strings.Contains(value, "\n") {
+				result.WriteString("  * " + key + value + "\n")
+				continue
 			}
-		})
-		
-		text := strings.TrimSpace(itemText.String())
-		if text != "" {
-			result.WriteString(prefix + text + "\n")
+			result.WriteString("  * " + strings.TrimSpace(key) + "\n")
+			result.WriteString(indentLines(value, "    ") + "\n")
 		}
-	})
+	}
 
 	return strings.TrimSpace(result.String())
 }
 
-func processCodeBlock(s *goquery.Selection) string {
-	if !s.Is("pre") {
-		return ""
-	}
-
-	code := strings.TrimSpace(s.Text())
-	if code == "" {
-		return ""
-	}
-
-	lang := ""
-	if s.HasClass("bash") {
-		lang = "bash"
-	} else if s.HasClass("shell") {
-		lang = "shell"
-	} else if s.HasClass("python") {
-		lang = "python"
+func renderFootnotes(footnotes []Footnote) string {
+	var lines []string
+	for _, footnote := range footnotes {
+		text := strings.TrimSpace(renderInlines(footnote.Inlines))
+		lines = append(lines, fmt.Sprintf("[^%s]: %s", footnote.Label, strings.ReplaceAll(text, "\n", " ")))
 	}
+	return strings.Join(lines, "\n")
+}
 
-	if lang != "" {
-		return fmt.Sprintf("```%s\n%s\n```", lang, code)
+func renderInlines(inlines []Inline) string {
+	var result strings.Builder
+	for _, inline := range inlines {
+		result.WriteString(renderInline(inline))
 	}
-	return fmt.Sprintf("```\n%s\n```", code)
+	return result.String()
 }
 
-func processTable(s *goquery.Selection) string {
-	if !s.Is("table") {
-		return ""
+func renderInline(inline Inline) string {
+	switch in := inline.(type) {
+	case Text:
+		return in.Text
+	case Code:
+		return fmt.Sprintf("`%s`", in.Text)
+	case Emphasis:
+		if text := strings.TrimSpace(renderInlines(in.Inlines)); text != "" {
+			return fmt.Sprintf("_%s_", text)
+		}
+	case Strong:
+		if text := strings.TrimSpace(renderInlines(in.Inlines)); text != "" {
+			return fmt.Sprintf("**%s**", text)
+		}
+	case Link:
+		text := strings.TrimSpace(renderInlines(in.Inlines))
+		if text == "" {
+			return ""
+		}
+		if in.Kind == LinkOther {
+			return text
+		}
+		text = in.displayText(text)
+		if in.namesPackage(text) {
+			text = "`" + text + "`"
+		}
+		return fmt.Sprintf("[%s](%s)", text, in.renderedHref())
+	case Image:
+		alt := strings.NewReplacer("[", `\[`, "]", `\]`, "\n", " ").Replace(in.Alt)
+		return fmt.Sprintf("![%s](%s)", alt, in.URL)
+	case FootnoteRef:
+		return fmt.Sprintf("[^%s]", in.Label)
+	case LineBreak:
+		return "\n"
 	}
+	return ""
+}
 
-	var result strings.Builder
-	
-	headers := []string{}
-	s.Find("tr").First().Find("th").Each(func(i int, s *goquery.Selection) {
-		headers = append(headers, strings.TrimSpace(s.Text()))
-	})
-
-	if len(headers) == 0 {
-		s.Find("tr").First().Find("td").Each(func(i int, s *goquery.Selection) {
-			headers = append(headers, strings.TrimSpace(s.Text()))
-		})
+func indentLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
 	}
+	return strings.Join(lines, "\n")
+}
 
-	if len(headers) > 0 {
-		result.WriteString("| " + strings.Join(headers, " | ") + " |\n")
-		result.WriteString("|" + strings.Repeat(" --- |", len(headers)) + "\n")
-	}
-	
-	s.Find("tr").Not(":first-child").Each(func(i int, s *goquery.Selection) {
-		cells := []string{}
-		s.Find("td").Each(func(j int, s *goquery.Selection) {
-			cells = append(cells, strings.TrimSpace(s.Text()))
-		})
-		if len(cells) > 0 {
-			result.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+func prefixLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = strings.TrimSpace(prefix)
+		} else {
+			lines[i] = prefix + line
 		}
-	})
-
-	return strings.TrimSpace(result.String())
-}
\ No newline at end of file
+	}
+	return strings.Join(lines, "\n")
+}
@@ -111,4 +111,71 @@ func TestConvertToMarkdown(t *testing.T) {
 	if strings.Contains(markdown, "](https://https://") {
 		t.Error("Found malformed external link with double protocol")
 	}
-} 
\ No newline at end of file
+}
+
+func TestProcessHeading(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "legacy headline span",
+			html: `<h2><span class="mw-headline" id="Principles">Principles</span><span class="mw-editsection"><span class="mw-editsection-bracket">[</span><a href="/index.php?action=edit">edit</a><span class="mw-editsection-bracket">]</span></span></h2>`,
+			want: "<a id=\"Principles\"></a>\n\n## Principles",
+		},
+		{
+			name: "mw-heading wrapper",
+			html: `<div class="mw-heading mw-heading3"><h3 id="Boot_loader">Boot loader</h3><span class="mw-editsection"><span class="mw-editsection-bracket">[</span><a href="/index.php?action=edit">edit</a><span class="mw-editsection-bracket">]</span></span></div>`,
+			want: "<a id=\"Boot_loader\"></a>\n\n### Boot loader",
+		},
+		{
+			name: "title mentioning edit",
+			html: `<h2 id="Edit_[edit]_links">Edit [edit] links</h2>`,
+			want: "<a id=\"Edit_[edit]_links\"></a>\n\n## Edit [edit] links",
+		},
+		{
+			name: "no anchor",
+			html: `<h4>Notes</h4>`,
+			want: "#### Notes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got := renderHeading(parseHeading(doc.Find("body").Children().First()))
+			if got != tt.want {
+				t.Errorf("parseHeading() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertToMarkdownFootnotes(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<div id="mw-content-text"><div class="mw-parser-output">
+		<p>Arch was founded in 2002.<sup id="cite_ref-1" class="reference"><a href="#cite_note-1">[1]</a></sup></p>
+		<ul><li>Rolling release<sup id="cite_ref-rr_2-0" class="reference"><a href="#cite_note-rr-2">[2]</a></sup></li></ul>
+		<div class="mw-references-wrap"><ol class="references">
+			<li id="cite_note-1"><span class="mw-cite-backlink"><a href="#cite_ref-1">↑</a></span> <span class="reference-text"><a href="https://archlinux.org/">Arch Linux</a> homepage</span></li>
+			<li id="cite_note-rr-2"><span class="mw-cite-backlink"><a href="#cite_ref-rr_2-0">↑</a></span> <span class="reference-text">See <i>FAQ</i></span></li>
+		</ol></div>
+		<p>After the references.</p>
+	</div></div>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	got := ConvertToMarkdown(doc.Find("div#mw-content-text"))
+	want := "Arch was founded in 2002.[^1]\n\n" +
+		"* Rolling release[^rr-2]\n\n" +
+		"After the references.\n\n" +
+		"[^1]: [Arch Linux](https://archlinux.org/) homepage\n" +
+		"[^rr-2]: See _FAQ_"
+	if got != want {
+		t.Errorf("ConvertToMarkdown() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+)
+
+var thumbPath = regexp.MustCompile(`^(.*)/thumb/(.+)/[^/]+$`)
+
+// mediaCollector downloads images. The crawl replaces it with a clone of its
+// own collector before fetching the first page.
+var mediaCollector = newMediaCollector(colly.NewCollector(colly.UserAgent(userAgent)))
+
+const mediaDestKey = "media_dest"
+
+// downloadLocks holds a mutex per destination file, so pages sharing an image
+// download it once.
+var downloadLocks sync.Map
+
+func parseFigure(s *goquery.Selection) []Block {
+	switch {
+	case s.Is("figure"):
+		return figureBlocks(s.Find("img").First(), s.ChildrenFiltered("figcaption"))
+	case s.Is("div.thumb"):
+		return figureBlocks(s.Find("img").First(), s.Find("div.thumbcaption"))
+	case s.Is("ul.gallery"):
+		var figures []Block
+		s.Find("li.gallerybox").Each(func(_ int, s *goquery.Selection) {
+			figures = append(figures, figureBlocks(s.Find("img").First(), s.Find("div.gallerytext"))...)
+		})
+		return figures
+	}
+	return nil
+}
+
+func figureBlocks(img, caption *goquery.Selection) []Block {
+	if img.Length() == 0 {
+		return nil
+	}
+
+	captionInlines := parseInlines(caption.Clone().Find(".magnify").Remove().End())
+	if inlinesEmpty(captionInlines) {
+		captionInlines = nil
+	}
+	image, ok := parseImage(img, strings.TrimSpace(plainInlines(captionInlines)))
+	if !ok {
+		return nil
+	}
+	return []Block{Figure{Image: image, Caption: captionInlines}}
+}
+
+func parseImage(img *goquery.Selection, fallbackAlt string) (Image, bool) {
+	src, _ := img.Attr("src")
+	imageURL := absoluteMediaURL(src)
+	if imageURL == "" {
+		return Image{}, false
+	}
+
+	alt := strings.TrimSpace(img.AttrOr("alt", ""))
+	if alt == "" {
+		alt = fallbackAlt
+	}
+	if alt == "" {
+		alt = strings.ReplaceAll(path.Base(imageURL), "_", " ")
+	}
+	return Image{URL: imageURL, Alt: alt}, true
+}
+
+func absoluteMediaURL(src string) string {
+	if src == "" || strings.HasPrefix(src, "data:") {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(src, "//"):
+		src = "https:" + src
+	case strings.HasPrefix(src, "/"):
+		src = baseURL + src
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	if m := thumbPath.FindStringSubmatch(u.Path); m != nil {
+		u.Path = m[1] + "/" + m[2]
+	}
+	u.RawPath = ""
+	return u.String()
+}
+
+var markdownImage = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// localizeMedia downloads images hosted on the wiki into the assets directory
+// shared by the pages of pageFile's directory and rewrites the image links to
+// point at the local copies.
+func localizeMedia(content, pageFile string) string {
+	assetsDir := filepath.Join(filepath.Dir(pageFile), "assets")
+
+	return markdownImage.ReplaceAllStringFunc(content, func(match string) string {
+		submatches := markdownImage.FindStringSubmatch(match)
+		alt, imageURL := submatches[1], submatches[2]
+		if !strings.HasPrefix(imageURL, baseURL+"/") {
+			return match
+		}
+
+		u, err := url.Parse(imageURL)
+		if err != nil {
+			return match
+		}
+		name := path.Base(u.Path)
+		if name == "." || name == "/" {
+			return match
+		}
+
+		localPath := filepath.Join(assetsDir, name)
+		if err := downloadFile(imageURL, localPath); err != nil {
+			log.Printf("Error downloading %s: %v", imageURL, err)
+			return match
+		}
+		return fmt.Sprintf("![%s](assets/%s)", alt, url.PathEscape(name))
+	})
+}
+
+// newMediaCollector returns a synchronous clone of c for downloading images.
+// A clone shares c's HTTP backend, so downloads wait for the same rate limit
+// and parallelism as page requests.
+func newMediaCollector(c *colly.Collector) *colly.Collector {
+	media := c.Clone()
+	media.Async = false
+	media.URLFilters = nil
+	media.AllowURLRevisit = true
+	media.MaxBodySize = 0
+	media.OnResponse(func(r *colly.Response) {
+		if err := saveMedia(r); err != nil {
+			r.Ctx.Put("error", err)
+		}
+	})
+	return media
+}
+
+func downloadFile(fileURL, dest string) error {
+	lock, _ := downloadLocks.LoadOrStore(dest, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	ctx := colly.NewContext()
+	ctx.Put(mediaDestKey, dest)
+	if err := mediaCollector.Request(http.MethodGet, fileURL, nil, ctx, nil); err != nil {
+		return err
+	}
+	if err, ok := ctx.GetAny("error").(error); ok {
+		return err
+	}
+	return nil
+}
+
+// saveMedia writes a downloaded image to the destination in its context
+// through a temporary file, so readers never see a partial image.
+func saveMedia(r *colly.Response) error {
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d %s", r.StatusCode, http.StatusText(r.StatusCode))
+	}
+	dest := r.Ctx.Get(mediaDestKey)
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(r.Body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+)
+
+func TestProcessFigure(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "figure with caption",
+			html: `<figure typeof="mw:File/Thumb"><a href="/title/File:Tux.png" class="mw-file-description"><img src="/images/thumb/a/ab/Tux.png/300px-Tux.png" alt="Tux the penguin" class="mw-file-element"></a><figcaption>The <a href="/title/Linux">Linux</a> mascot</figcaption></figure>`,
+			want: "![Tux the penguin](https://wiki.archlinux.org/images/a/ab/Tux.png)\n\n_The [Linux](/title/Linux) mascot_",
+		},
+		{
+			name: "legacy thumb uses caption as alt",
+			html: `<div class="thumb tright"><div class="thumbinner"><a class="image"><img src="//wiki.archlinux.org/images/c/cd/Boot.svg"></a><div class="thumbcaption"><div class="magnify"><a href="/title/File:Boot.svg"></a></div>Boot process</div></div></div>`,
+			want: "![Boot process](https://wiki.archlinux.org/images/c/cd/Boot.svg)\n\n_Boot process_",
+		},
+		{
+			name: "gallery",
+			html: `<ul class="gallery"><li class="gallerybox"><img src="/images/a.png" alt="A"><div class="gallerytext">First</div></li><li class="gallerybox"><img src="/images/b.png"></li></ul>`,
+			want: "![A](https://wiki.archlinux.org/images/a.png)\n\n_First_\n\n![b.png](https://wiki.archlinux.org/images/b.png)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got := renderBlocks(parseFigure(doc.Find("body").Children().First()))
+			if got != tt.want {
+				t.Errorf("parseFigure() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizeMedia(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/a/ab/Tux.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	oldBaseURL := baseURL
+	baseURL = server.URL
+	defer func() { baseURL = oldBaseURL }()
+
+	dir := t.TempDir()
+	pageFile := filepath.Join(dir, "Arch_Linux.md")
+	content := "![Tux](" + server.URL + "/images/a/ab/Tux.png) and ![Missing](" + server.URL + "/images/missing.png) and ![Other](https://example.com/x.png)"
+
+	got := localizeMedia(content, pageFile)
+	want := "![Tux](assets/Tux.png) and ![Missing](" + server.URL + "/images/missing.png) and ![Other](https://example.com/x.png)"
+	if got != want {
+		t.Errorf("localizeMedia() = %q, want %q", got, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "assets", "Tux.png"))
+	if err != nil {
+		t.Fatalf("Expected downloaded asset: %v", err)
+	}
+	if string(data) != "png" {
+		t.Errorf("Downloaded asset = %q, want %q", data, "png")
+	}
+}
+
+func TestDownloadFileConcurrent(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(strings.Repeat("png", 1000)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "assets", "Tux.png")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := downloadFile(server.URL+"/images/Tux.png", dest); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("downloaded %d times, want 1", n)
+	}
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "Tux.png" {
+		t.Errorf("assets = %v, want only Tux.png", entries)
+	}
+}
+
+func TestDownloadFileRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	c := colly.NewCollector()
+	c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: 1, Delay: 50 * time.Millisecond})
+	defer func(media *colly.Collector) { mediaCollector = media }(mediaCollector)
+	mediaCollector = newMediaCollector(c)
+
+	dir := t.TempDir()
+	start := time.Now()
+	for _, name := range []string{"A.png", "B.png", "C.png"} {
+		if err := downloadFile(server.URL+"/images/"+name, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("three downloads took %v, want the collector's delay after each", elapsed)
+	}
+}
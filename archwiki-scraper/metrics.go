@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The metrics are updated by crawlStats, so they always agree with the run
+// report.
+var (
+	metricsRegistry = prometheus.NewRegistry()
+	metrics         = promauto.With(metricsRegistry)
+
+	queueDepthGauge = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "archwiki_scraper_queue_depth",
+		Help: "Pages of the current depth not yet fetched and processed.",
+	})
+	crawlDepthGauge = metrics.NewGauge(prometheus.GaugeOpts{
+		Name: "archwiki_scraper_crawl_depth",
+		Help: "Depth currently being crawled.",
+	})
+	pagesFetchedCounter = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "archwiki_scraper_pages_fetched_total",
+		Help: "Pages fetched successfully.",
+	})
+	pagesSavedCounter = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "archwiki_scraper_pages_saved_total",
+		Help: "Pages converted and saved.",
+	})
+	requestErrorsCounter = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "archwiki_scraper_request_errors_total",
+		Help: "Failed requests by HTTP status, or \"network\" when there was no response.",
+	}, []string{"status"})
+	conversionDuration = metrics.NewHistogram(prometheus.HistogramOpts{
+		Name:    "archwiki_scraper_conversion_duration_seconds",
+		Help:    "Time spent converting and saving a fetched page.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+	bytesWrittenCounter = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "archwiki_scraper_bytes_written_total",
+		Help: "Bytes of converted pages written to the output directory.",
+	})
+)
+
+// crawlStatus is the JSON served at /status.
+type crawlStatus struct {
+	RunReport
+	Depth          int     `json:"depth"`
+	QueueDepth     int     `json:"queue_depth"`
+	PagesPerSecond float64 `json:"pages_per_second"`
+}
+
+// metricsHandler serves the Prometheus metrics and the status of the crawl
+// counted by s.
+func metricsHandler(s *crawlStats) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s.status())
+	})
+	return mux
+}
+
+// serveMetrics serves /metrics and /status for the crawl counted by s on addr
+// in the background for as long as the crawl runs.
+func serveMetrics(addr string, s *crawlStats) {
+	server := &http.Server{Addr: addr, Handler: metricsHandler(s)}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Error serving metrics: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on %s", addr)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	stats := newCrawlStats()
+	stats.startDepth(1, 3)
+	stats.fetched(1, 2048)
+	stats.saved(1)
+	stats.wrote(512)
+	stats.converted(20 * time.Millisecond)
+	stats.done()
+	stats.errored(503)
+	stats.done()
+
+	server := httptest.NewServer(metricsHandler(stats))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		"archwiki_scraper_queue_depth 1\n",
+		"archwiki_scraper_crawl_depth 1\n",
+		"archwiki_scraper_pages_fetched_total ",
+		"archwiki_scraper_pages_saved_total ",
+		`archwiki_scraper_request_errors_total{status="503"} `,
+		"archwiki_scraper_conversion_duration_seconds_bucket{le=\"0.02\"} ",
+		"archwiki_scraper_bytes_written_total ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics missing %q", want)
+		}
+	}
+
+	resp, err = server.Client().Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var status crawlStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("invalid /status JSON: %v", err)
+	}
+	if status.Depth != 1 || status.QueueDepth != 1 || status.PagesFetched != 1 || status.BytesWritten != 512 ||
+		status.ErrorsByStatus["503"] != 1 || status.PagesPerSecond <= 0 {
+		t.Errorf("/status = %+v", status)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var outputFormats = map[string]string{
+	"markdown":  ".md",
+	"plaintext": ".txt",
+	"json":      ".json",
+	"html":      ".html",
+}
+
+type jsonPage struct {
+	Title     string         `json:"title"`
+	URL       string         `json:"url"`
+	Sections  []jsonSection  `json:"sections"`
+	Links     []OutboundLink `json:"links"`
+	Footnotes []jsonLink     `json:"footnotes,omitempty"`
+	Metadata  jsonMetadata   `json:"metadata"`
+}
+
+type jsonSection struct {
+	HeadingPath []string `json:"heading_path"`
+	Level       int      `json:"level"`
+	Anchor      string   `json:"anchor,omitempty"`
+	Content     string   `json:"content"`
+}
+
+type jsonLink struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+type jsonMetadata struct {
+	CanonicalURL string   `json:"canonical_url,omitempty"`
+	Aliases      []string `json:"aliases,omitempty"`
+	RevisionID   int64    `json:"revision_id,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Categories   []string `json:"categories,omitempty"`
+	Language     string   `json:"language,omitempty"`
+	Importance   float64  `json:"importance,omitempty"`
+	ContentHash  string   `json:"content_hash"`
+	DateScraped  string   `json:"date_scraped"`
+	WordCount    int      `json:"word_count"`
+}
+
+func formatExtension(format string) string {
+	if ext, ok := outputFormats[format]; ok {
+		return ext
+	}
+	return ".md"
+}
+
+func renderPage(format string, doc *Document, filename string, meta PageMeta) ([]byte, error) {
+	switch format {
+	case "markdown":
+		content := convertWikiLinks(RenderMarkdown(doc))
+		if *downloadMedia {
+			content = localizeMedia(content, filename)
+		}
+		if *tableOfContents {
+			if toc := renderTOC(doc); toc != "" {
+				content = toc + "\n\n" + content
+			}
+		}
+		meta.WordCount = len(strings.Fields(RenderPlainText(doc)))
+		meta.ContentHash = contentHash(content)
+		meta.Sections = sectionIndex(doc, content)
+		meta.Links = doc.OutboundLinks()
+		frontMatter, err := renderFrontMatter(meta)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(frontMatter + "\n" + content), nil
+	case "plaintext":
+		return []byte(meta.Title + "\n\n" + RenderPlainText(doc) + "\n"), nil
+	case "json":
+		data, err := json.MarshalIndent(buildJSONPage(doc, meta), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "html":
+		return []byte(RenderHTML(doc, meta.Title)), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// buildJSONPage returns the JSON form of a page, with the page metadata the
+// markdown front matter holds. Its content hash covers the plain text of the
+// sections.
+func buildJSONPage(doc *Document, meta PageMeta) jsonPage {
+	text := RenderPlainText(doc)
+	page := jsonPage{
+		Title:    meta.Title,
+		URL:      meta.URL,
+		Sections: []jsonSection{},
+		Links:    doc.OutboundLinks(),
+		Metadata: jsonMetadata{
+			CanonicalURL: meta.CanonicalURL,
+			Aliases:      meta.Aliases,
+			RevisionID:   meta.RevisionID,
+			Categories:   meta.Categories,
+			Language:     meta.Language,
+			Importance:   meta.Importance,
+			ContentHash:  contentHash(text),
+			DateScraped:  meta.DateScraped.Format(time.RFC3339),
+			WordCount:    len(strings.Fields(text)),
+		},
+	}
+	if !meta.LastModified.IsZero() {
+		page.Metadata.LastModified = meta.LastModified.Format(time.RFC3339)
+	}
+
+	if content := plainBlocks(doc.Blocks); content != "" {
+		page.Sections = append(page.Sections, jsonSection{HeadingPath: []string{}, Content: content})
+	}
+	doc.WalkSections(func(path []string, s *Section) {
+		page.Sections = append(page.Sections, jsonSection{
+			HeadingPath: path,
+			Level:       s.Level,
+			Anchor:      s.Anchor,
+			Content:     plainBlocks(s.Blocks),
+		})
+	})
+
+	if page.Links == nil {
+		page.Links = []OutboundLink{}
+	}
+
+	for _, footnote := range doc.Footnotes {
+		page.Footnotes = append(page.Footnotes, jsonLink{
+			Text: strings.TrimSpace(plainInlines(footnote.Inlines)),
+			URL:  footnoteURL(footnote),
+		})
+	}
+
+	return page
+}
+
+// pageText lays out the sections of a JSON page as markdown headings and
+// text, and indexes the headings the way front matter does, for commands that
+// read pages back.
+func (p jsonPage) pageText() (string, []SectionEntry) {
+	var body strings.Builder
+	var entries []SectionEntry
+	offset := 0
+	write := func(text string) {
+		body.WriteString(text)
+		offset += utf8.RuneCountInString(text)
+	}
+	for _, section := range p.Sections {
+		if len(section.HeadingPath) > 0 {
+			if body.Len() > 0 {
+				write("\n")
+			}
+			title := section.HeadingPath[len(section.HeadingPath)-1]
+			entries = append(entries, SectionEntry{Level: section.Level, Title: title, Anchor: section.Anchor, Offset: offset})
+			write(strings.Repeat("#", section.Level) + " " + title + "\n\n")
+		}
+		if section.Content != "" {
+			write(section.Content + "\n")
+		}
+	}
+	return body.String(), entries
+}
+
+// pageMeta returns the metadata and links of a JSON page as the fields of
+// markdown front matter.
+func (p jsonPage) pageMeta() PageMeta {
+	meta := PageMeta{
+		Title:        p.Title,
+		URL:          p.URL,
+		CanonicalURL: p.Metadata.CanonicalURL,
+		Aliases:      p.Metadata.Aliases,
+		RevisionID:   p.Metadata.RevisionID,
+		Categories:   p.Metadata.Categories,
+		Language:     p.Metadata.Language,
+		Importance:   p.Metadata.Importance,
+		WordCount:    p.Metadata.WordCount,
+		ContentHash:  p.Metadata.ContentHash,
+		Links:        p.Links,
+	}
+	meta.LastModified, _ = time.Parse(time.RFC3339, p.Metadata.LastModified)
+	meta.DateScraped, _ = time.Parse(time.RFC3339, p.Metadata.DateScraped)
+	return meta
+}
+
+func footnoteURL(footnote Footnote) string {
+	for _, link := range inlineLinks(footnote.Inlines) {
+		if strings.HasPrefix(link.Href, "http") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+func absoluteURL(href string) string {
+	if strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//") {
+		return baseURL + href
+	}
+	return href
+}
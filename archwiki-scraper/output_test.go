@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildJSONPage(t *testing.T) {
+	doc := parseTestDocument(t, `
+		<p>Arch uses <a href="/title/Pacman">pacman</a>.</p>
+		<h2 id="Usage">Usage</h2>
+		<p>Run <a href="https://example.com/">it</a>.<sup class="reference"><a href="#cite_note-1">[1]</a></sup></p>
+		<h3 id="Flags">Flags</h3>
+		<ul><li><code>-S</code></li></ul>
+		<ol class="references"><li id="cite_note-1"><span class="reference-text"><a href="https://archlinux.org/">Homepage</a></span></li></ol>`)
+
+	meta := PageMeta{
+		Title:        "Pacman",
+		URL:          "https://wiki.archlinux.org/title/Pacman",
+		CanonicalURL: "https://wiki.archlinux.org/title/Pacman",
+		Aliases:      []string{"Pacman_(package_manager)"},
+		RevisionID:   812345,
+		LastModified: time.Date(2025, 2, 20, 9, 30, 0, 0, time.UTC),
+		Categories:   []string{"Package manager"},
+		Language:     "en",
+		DateScraped:  time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	got := buildJSONPage(doc, meta)
+
+	want := jsonPage{
+		Title: "Pacman",
+		URL:   "https://wiki.archlinux.org/title/Pacman",
+		Sections: []jsonSection{
+			{HeadingPath: []string{}, Content: "Arch uses pacman."},
+			{HeadingPath: []string{"Usage"}, Level: 2, Anchor: "Usage", Content: "Run it.[1]"},
+			{HeadingPath: []string{"Usage", "Flags"}, Level: 3, Anchor: "Flags", Content: "- -S"},
+		},
+		Links: []OutboundLink{
+			{Kind: LinkWiki, URL: "https://wiki.archlinux.org/title/Pacman", Text: "pacman", Target: "Pacman"},
+			{Kind: LinkExternal, URL: "https://example.com/", Text: "it"},
+			{Kind: LinkExternal, URL: "https://archlinux.org/", Text: "Homepage"},
+		},
+		Footnotes: []jsonLink{{Text: "Homepage", URL: "https://archlinux.org/"}},
+		Metadata: jsonMetadata{
+			CanonicalURL: "https://wiki.archlinux.org/title/Pacman",
+			Aliases:      []string{"Pacman_(package_manager)"},
+			RevisionID:   812345,
+			LastModified: "2025-02-20T09:30:00Z",
+			Categories:   []string{"Package manager"},
+			Language:     "en",
+			ContentHash:  contentHash(RenderPlainText(doc)),
+			DateScraped:  "2025-03-01T12:00:00Z",
+			WordCount:    11,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildJSONPage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRenderPageFormats(t *testing.T) {
+	doc := parseTestDocument(t, `<h2 id="A_&amp;_B">A &amp; B</h2><p>Use <a href="/title/Pacman">pacman</a> &lt;pkg&gt;.</p>`)
+	meta := PageMeta{
+		Title:       "Test",
+		URL:         "https://wiki.archlinux.org/title/Test",
+		DateScraped: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"markdown", []string{"---\ntitle: Test\n", "date_scraped: 2025-03-01T12:00:00Z\n", "links:\n  - kind: wiki\n", "## A & B", "[pacman](Pacman.md)"}},
+		{"plaintext", []string{"Test\n\nA & B\n\nUse pacman <pkg>."}},
+		{"json", []string{`"heading_path": [`, `"content": "Use pacman \u003cpkg\u003e."`}},
+		{"html", []string{`<h2 id="A_&amp;_B">A &amp; B</h2>`, `<a href="https://wiki.archlinux.org/title/Pacman">pacman</a> &lt;pkg&gt;.`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := renderPage(tt.format, doc, "output/Test"+formatExtension(tt.format), meta)
+			if err != nil {
+				t.Fatalf("renderPage() error: %v", err)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(string(got), part) {
+					t.Errorf("renderPage() output missing %q:\n%s", part, got)
+				}
+			}
+			if tt.format == "json" && !json.Valid(got) {
+				t.Errorf("renderPage() produced invalid JSON")
+			}
+		})
+	}
+
+	if _, err := renderPage("pdf", doc, "output/Test.pdf", meta); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "nested table kept",
+			html: `<table class="wikitable"><tbody><tr><td colspan="2" style="color:red"><table><tr><td>inner</td></tr></table></td></tr></tbody></table>`,
+			want: `<table><tbody><tr><td colspan="2"><table><tbody><tr><td>inner</td></tr></tbody></table></td></tr></tbody></table>`,
+		},
+		{
+			name: "scripts dropped and wrappers unwrapped",
+			html: `<div onclick="x()"><span>a &amp; b</span><script>alert(1)</script><br></div>`,
+			want: `a &amp; b<br>`,
+		},
+		{
+			name: "links made absolute or dropped",
+			html: `<p><a href="/title/Pacman">pacman</a> <a href="javascript:alert(1)">x</a></p>`,
+			want: `<p><a href="https://wiki.archlinux.org/title/Pacman">pacman</a> <a>x</a></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.html); got != tt.want {
+				t.Errorf("sanitizeHTML() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLTableSpans(t *testing.T) {
+	doc := parseTestDocument(t, `<table>
+		<tr><th>Option</th><th>Default</th><th>Notes</th></tr>
+		<tr><td colspan="2">wide</td><td rowspan="2">tall</td></tr>
+		<tr><td>a</td><td>b</td></tr>
+	</table>`)
+	got := RenderHTML(doc, "Test")
+	for _, want := range []string{`<td colspan="2"><p>wide</p>`, `<td rowspan="2"><p>tall</p>`, "</tr>\n<tr><td><p>a</p>\n</td><td><p>b</p>\n</td></tr>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("RenderHTML() missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "wide") != 1 || strings.Count(got, "tall") != 1 {
+		t.Errorf("RenderHTML() repeats spanning cells:\n%s", got)
+	}
+}
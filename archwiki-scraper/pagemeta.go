@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+)
+
+// PageMeta is the front matter written at the top of every markdown page.
+// ContentHash is the hex SHA-256 of the page body that follows it. Importance
+// is only set by the graph command and scales the page's PageRank so that the
+// highest ranked page scores 1.
+type PageMeta struct {
+	Title        string         `yaml:"title"`
+	URL          string         `yaml:"url"`
+	CanonicalURL string         `yaml:"canonical_url,omitempty"`
+	Aliases      []string       `yaml:"aliases,omitempty"`
+	RevisionID   int64          `yaml:"revision_id,omitempty"`
+	LastModified time.Time      `yaml:"last_modified,omitempty"`
+	Categories   []string       `yaml:"categories,omitempty"`
+	Language     string         `yaml:"language,omitempty"`
+	Importance   float64        `yaml:"importance,omitempty"`
+	WordCount    int            `yaml:"word_count"`
+	ContentHash  string         `yaml:"content_hash"`
+	DateScraped  time.Time      `yaml:"date_scraped"`
+	Sections     []SectionEntry `yaml:"sections"`
+	Links        []OutboundLink `yaml:"links"`
+}
+
+var (
+	revisionIDPattern = regexp.MustCompile(`"wgRevisionId":(\d+)`)
+	pageNamePattern   = regexp.MustCompile(`"wgPageName":"((?:[^"\\]|\\.)*)"`)
+	lastEditedPattern = regexp.MustCompile(`last edited on (\d{1,2} \w+ \d{4}), at (\d{2}:\d{2})`)
+)
+
+// extractPageMeta reads the page-level metadata MediaWiki embeds outside the
+// article content. page must contain the whole HTML document.
+func extractPageMeta(page *goquery.Selection, pageURL string) PageMeta {
+	meta := PageMeta{URL: pageURL}
+
+	meta.CanonicalURL = page.Find(`link[rel="canonical"]`).AttrOr("href", "")
+	scripts := page.Find("script").Text()
+	if meta.CanonicalURL == "" {
+		if m := pageNamePattern.FindStringSubmatch(scripts); m != nil {
+			if name, err := strconv.Unquote(`"` + m[1] + `"`); err == nil {
+				meta.CanonicalURL = baseURL + "/title/" + name
+			}
+		}
+	}
+	if m := revisionIDPattern.FindStringSubmatch(scripts); m != nil {
+		meta.RevisionID, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+
+	if m := lastEditedPattern.FindStringSubmatch(page.Find("#footer-info-lastmod").Text()); m != nil {
+		if t, err := time.Parse("2 January 2006 15:04", m[1]+" "+m[2]); err == nil {
+			meta.LastModified = t
+		}
+	}
+
+	page.Find("#mw-normal-catlinks li a").Each(func(i int, s *goquery.Selection) {
+		if category := strings.TrimSpace(s.Text()); category != "" {
+			meta.Categories = append(meta.Categories, category)
+		}
+	})
+
+	meta.Language, _ = page.Find("html").Attr("lang")
+	return meta
+}
+
+// documentRoot returns the document containing s, so metadata outside the
+// selection can be found.
+func documentRoot(s *goquery.Selection) *goquery.Selection {
+	if s.Length() == 0 {
+		return s
+	}
+	n := s.Nodes[0]
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return goquery.NewDocumentFromNode(n).Selection
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func renderFrontMatter(meta PageMeta) (string, error) {
+	if meta.Sections == nil {
+		meta.Sections = []SectionEntry{}
+	}
+	if meta.Links == nil {
+		meta.Links = []OutboundLink{}
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(meta); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return "---\n" + b.String() + "---\n", nil
+}
+
+// parseFrontMatter splits a markdown page written by renderPage into its
+// metadata and body.
+func parseFrontMatter(content string) (PageMeta, string, error) {
+	var meta PageMeta
+	end := strings.Index(content, "\n---\n\n")
+	if !strings.HasPrefix(content, "---\n") || end < 0 {
+		return meta, "", fmt.Errorf("missing front matter")
+	}
+	if err := yaml.Unmarshal([]byte(content[len("---\n"):end]), &meta); err != nil {
+		return meta, "", err
+	}
+	return meta, content[end+len("\n---\n\n"):], nil
+}
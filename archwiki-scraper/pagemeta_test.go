@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExtractPageMeta(t *testing.T) {
+	f, err := os.Open("testdata/arch_linux.html")
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	got := extractPageMeta(documentRoot(doc.Find("div#mw-content-text")), "https://wiki.archlinux.org/title/Arch_Linux")
+	want := PageMeta{
+		URL:          "https://wiki.archlinux.org/title/Arch_Linux",
+		CanonicalURL: "https://wiki.archlinux.org/title/Arch_Linux",
+		RevisionID:   821019,
+		LastModified: time.Date(2024, 11, 19, 19, 34, 0, 0, time.UTC),
+		Categories:   []string{"About Arch"},
+		Language:     "en",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractPageMeta() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRenderFrontMatter(t *testing.T) {
+	meta := PageMeta{
+		Title:       `DeveloperWiki:Project "Leader"`,
+		URL:         "https://wiki.archlinux.org/title/DeveloperWiki:Project_Leader",
+		Categories:  []string{"DeveloperWiki: misc"},
+		WordCount:   3,
+		ContentHash: contentHash("body"),
+		DateScraped: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Sections:    []SectionEntry{{Level: 2, Title: "Role: duties", Anchor: "Role:_duties", Offset: 10}},
+	}
+
+	got, err := renderFrontMatter(meta)
+	if err != nil {
+		t.Fatalf("renderFrontMatter() error = %v", err)
+	}
+	if !strings.HasPrefix(got, "---\n") || !strings.HasSuffix(got, "\n---\n") {
+		t.Fatalf("front matter not delimited:\n%s", got)
+	}
+	for _, unwanted := range []string{"revision_id", "last_modified", "canonical_url"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("expected empty %s to be omitted:\n%s", unwanted, got)
+		}
+	}
+
+	var decoded PageMeta
+	if err := yaml.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(got, "---\n"), "---\n")), &decoded); err != nil {
+		t.Fatalf("front matter is not valid YAML: %v\n%s", err, got)
+	}
+	meta.Links = []OutboundLink{}
+	if !reflect.DeepEqual(decoded, meta) {
+		t.Errorf("decoded front matter = %+v, want %+v", decoded, meta)
+	}
+}
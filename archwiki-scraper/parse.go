@@ -0,0 +1,313 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const blockElements = "p, div, ul, ol, dl, pre, table, figure, blockquote, h1, h2, h3, h4, h5, h6"
+
+var admonitionKinds = []string{"note", "tip", "warning"}
+
+func ParseDocument(s *goquery.Selection) *Document {
+	content := s.Find("div.mw-parser-output")
+	if content.Length() == 0 {
+		return nil
+	}
+
+	doc := &Document{Title: strings.TrimSpace(s.Find("h1#firstHeading").Text())}
+
+	var stack []*Section
+	var flow flowBuilder
+	target := &doc.Blocks
+	content.Contents().Each(func(i int, s *goquery.Selection) {
+		if shouldSkipElement(s) || isCodeCaption(s) {
+			return
+		}
+
+		if section := parseHeading(s); section != nil {
+			*target = append(*target, flow.finish()...)
+			for len(stack) > 0 && stack[len(stack)-1].Level >= section.Level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				doc.Sections = append(doc.Sections, section)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Sections = append(parent.Sections, section)
+			}
+			stack = append(stack, section)
+			target = &section.Blocks
+			return
+		}
+
+		if footnotes := parseReferences(s); len(footnotes) > 0 {
+			doc.Footnotes = append(doc.Footnotes, footnotes...)
+			return
+		}
+
+		flow.add(s)
+	})
+	*target = append(*target, flow.finish()...)
+
+	return doc
+}
+
+// flowBuilder groups a run of sibling nodes into blocks, collecting loose
+// inline content into paragraphs between block-level elements.
+type flowBuilder struct {
+	blocks  []Block
+	inlines []Inline
+}
+
+func (f *flowBuilder) add(s *goquery.Selection) {
+	if shouldSkipElement(s) || isCodeCaption(s) {
+		return
+	}
+	if s.Is(blockElements) {
+		f.flush()
+		f.blocks = append(f.blocks, parseBlock(s)...)
+		return
+	}
+	f.inlines = append(f.inlines, parseInlineNode(s)...)
+}
+
+func (f *flowBuilder) flush() {
+	if !inlinesEmpty(f.inlines) {
+		f.blocks = append(f.blocks, Paragraph{Inlines: f.inlines})
+	}
+	f.inlines = nil
+}
+
+func (f *flowBuilder) finish() []Block {
+	f.flush()
+	blocks := f.blocks
+	f.blocks = nil
+	return blocks
+}
+
+func parseFlow(s *goquery.Selection) []Block {
+	var flow flowBuilder
+	s.Contents().Each(func(i int, s *goquery.Selection) {
+		flow.add(s)
+	})
+	return flow.finish()
+}
+
+func parseBlock(s *goquery.Selection) []Block {
+	if section := parseHeading(s); section != nil {
+		return []Block{Paragraph{Inlines: []Inline{Strong{Inlines: []Inline{Text{Text: section.Title}}}}}}
+	}
+	if para := parseParagraph(s); para != nil {
+		return []Block{para}
+	}
+	if figures := parseFigure(s); len(figures) > 0 {
+		return figures
+	}
+	if list := parseList(s); list != nil {
+		return []Block{list}
+	}
+	if dl := parseDefinitionList(s); dl != nil {
+		return []Block{dl}
+	}
+	if code := parseCodeBlock(s); code != nil {
+		return []Block{code}
+	}
+	if table := parseTable(s); table != nil {
+		return []Block{table}
+	}
+	if admonition := parseAdmonition(s); admonition != nil {
+		return []Block{admonition}
+	}
+	if s.Is("blockquote") {
+		if blocks := parseFlow(s); len(blocks) > 0 {
+			return []Block{Quote{Blocks: blocks}}
+		}
+		return nil
+	}
+	if s.Is("div") {
+		return parseFlow(s)
+	}
+	return nil
+}
+
+func shouldSkipElement(s *goquery.Selection) bool {
+	return activeSkipRules.skip(s)
+}
+
+func parseHeading(s *goquery.Selection) *Section {
+	heading := s
+	if s.Is("div.mw-heading") {
+		heading = s.ChildrenFiltered("h1, h2, h3, h4, h5, h6").First()
+	}
+	if !heading.Is("h1, h2, h3, h4, h5, h6") {
+		return nil
+	}
+
+	title := strings.TrimSpace(collapseWhitespace(
+		heading.Clone().Find(".mw-editsection").Remove().End().Text()))
+	if title == "" {
+		return nil
+	}
+
+	return &Section{
+		Level:  int(goquery.NodeName(heading)[1] - '0'),
+		Title:  title,
+		Anchor: headingAnchor(heading),
+	}
+}
+
+func headingAnchor(heading *goquery.Selection) string {
+	if id, exists := heading.Attr("id"); exists && id != "" {
+		return id
+	}
+	id, _ := heading.Find("span.mw-headline").Attr("id")
+	return id
+}
+
+func parseParagraph(s *goquery.Selection) Block {
+	if !s.Is("p") {
+		return nil
+	}
+
+	inlines := parseInlines(s)
+	if inlinesEmpty(inlines) {
+		return nil
+	}
+	return Paragraph{Inlines: inlines}
+}
+
+func parseList(s *goquery.Selection) Block {
+	if !s.Is("ul, ol") {
+		return nil
+	}
+
+	list := List{Ordered: s.Is("ol")}
+	s.ChildrenFiltered("li").Each(func(i int, s *goquery.Selection) {
+		if blocks := parseFlow(s); len(blocks) > 0 {
+			list.Items = append(list.Items, ListItem{Blocks: blocks})
+		}
+	})
+	if len(list.Items) == 0 {
+		return nil
+	}
+	return list
+}
+
+func parseDefinitionList(s *goquery.Selection) Block {
+	if !s.Is("dl") {
+		return nil
+	}
+
+	var dl DefinitionList
+	s.ChildrenFiltered("dt, dd").Each(func(i int, s *goquery.Selection) {
+		if s.Is("dt") {
+			if term := parseInlines(s); !inlinesEmpty(term) {
+				dl.Items = append(dl.Items, Definition{Term: term})
+			}
+			return
+		}
+		blocks := parseFlow(s)
+		if len(blocks) == 0 {
+			return
+		}
+		if len(dl.Items) == 0 || len(dl.Items[len(dl.Items)-1].Blocks) > 0 && dl.Items[len(dl.Items)-1].Term == nil {
+			dl.Items = append(dl.Items, Definition{})
+		}
+		last := &dl.Items[len(dl.Items)-1]
+		last.Blocks = append(last.Blocks, blocks...)
+	})
+	if len(dl.Items) == 0 {
+		return nil
+	}
+	return dl
+}
+
+func parseAdmonition(s *goquery.Selection) Block {
+	if !s.Is("div.archwiki-template-box") {
+		return nil
+	}
+
+	kind := "note"
+	for _, k := range admonitionKinds {
+		if s.HasClass("archwiki-template-box-" + k) {
+			kind = k
+		}
+	}
+
+	body := s.Clone()
+	if label := body.Children().First(); label.Is("strong, b") && strings.HasSuffix(strings.TrimSpace(label.Text()), ":") {
+		label.Remove()
+	}
+	blocks := parseFlow(body)
+	if len(blocks) == 0 {
+		return nil
+	}
+	return Admonition{Kind: kind, Blocks: blocks}
+}
+
+func parseInlines(s *goquery.Selection) []Inline {
+	var inlines []Inline
+	s.Contents().Each(func(i int, s *goquery.Selection) {
+		inlines = append(inlines, parseInlineNode(s)...)
+	})
+	return inlines
+}
+
+func parseInlineNode(s *goquery.Selection) []Inline {
+	if goquery.NodeName(s) == "#text" {
+		return []Inline{Text{Text: collapseWhitespace(s.Text())}}
+	}
+	if shouldSkipElement(s) {
+		return nil
+	}
+	switch {
+	case s.Is("sup.reference"):
+		if ref := parseFootnoteRef(s); ref != nil {
+			return []Inline{ref}
+		}
+		return nil
+	case s.Is("sup") && strings.TrimSpace(s.Text()) == "AUR":
+		return nil
+	case s.Is("img"):
+		if image, ok := parseImage(s, ""); ok {
+			return []Inline{image}
+		}
+		return nil
+	case s.Is("a") && s.Find("img").Length() > 0:
+		return parseInlines(s)
+	case s.Is("a"):
+		href, exists := s.Attr("href")
+		if !exists {
+			return parseInlines(s)
+		}
+		interwikiTitle := ""
+		if s.HasClass("extiw") {
+			interwikiTitle = s.AttrOr("title", "")
+		}
+		link := classifyLink(href, interwikiTitle)
+		link.Inlines = parseInlines(s)
+		return []Inline{link}
+	case s.Is("code"):
+		return []Inline{Code{Text: s.Text()}}
+	case s.Is("i, em"):
+		return []Inline{Emphasis{Inlines: parseInlines(s)}}
+	case s.Is("b, strong"):
+		return []Inline{Strong{Inlines: parseInlines(s)}}
+	case s.Is("br"):
+		return []Inline{LineBreak{}}
+	}
+	return parseInlines(s)
+}
+
+func inlinesEmpty(inlines []Inline) bool {
+	return strings.TrimSpace(plainInlines(inlines)) == ""
+}
+
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+func collapseWhitespace(text string) string {
+	return whitespaceRun.ReplaceAllString(text, " ")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func parseTestDocument(t *testing.T, content string) *Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<div id="mw-content-text"><div class="mw-parser-output">` + content + `</div></div>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	return ParseDocument(doc.Find("div#mw-content-text"))
+}
+
+func TestParseDocumentSections(t *testing.T) {
+	doc := parseTestDocument(t, `
+		<p>Intro.</p>
+		<div class="mw-heading mw-heading2"><h2 id="Installation">Installation</h2></div>
+		<p>Install it.</p>
+		<h3><span class="mw-headline" id="Packages">Packages</span></h3>
+		<ul><li>base<ul><li>linux</li></ul></li></ul>
+		<h2 id="Tips">Tips</h2>
+		<div class="archwiki-template-box archwiki-template-box-tip"><strong>Tip:</strong> Use <code>-S</code>.</div>
+		<dl><dt>Term</dt><dd>Meaning</dd></dl>`)
+
+	want := &Document{
+		Blocks: []Block{Paragraph{Inlines: []Inline{Text{Text: "Intro."}}}},
+		Sections: []*Section{
+			{
+				Level:  2,
+				Title:  "Installation",
+				Anchor: "Installation",
+				Blocks: []Block{Paragraph{Inlines: []Inline{Text{Text: "Install it."}}}},
+				Sections: []*Section{{
+					Level:  3,
+					Title:  "Packages",
+					Anchor: "Packages",
+					Blocks: []Block{List{Items: []ListItem{{Blocks: []Block{
+						Paragraph{Inlines: []Inline{Text{Text: "base"}}},
+						List{Items: []ListItem{{Blocks: []Block{Paragraph{Inlines: []Inline{Text{Text: "linux"}}}}}}},
+					}}}}},
+				}},
+			},
+			{
+				Level:  2,
+				Title:  "Tips",
+				Anchor: "Tips",
+				Blocks: []Block{
+					Admonition{Kind: "tip", Blocks: []Block{Paragraph{Inlines: []Inline{
+						Text{Text: " Use "}, Code{Text: "-S"}, Text{Text: "."},
+					}}}},
+					DefinitionList{Items: []Definition{{
+						Term:   []Inline{Text{Text: "Term"}},
+						Blocks: []Block{Paragraph{Inlines: []Inline{Text{Text: "Meaning"}}}},
+					}}},
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("ParseDocument() = %#v, want %#v", doc, want)
+	}
+}
+
+func TestParseDocumentInlines(t *testing.T) {
+	doc := parseTestDocument(t, `<p>See <a href="/title/Pacman"><i>pacman</i></a> and <b>note</b><br>next</p>`)
+
+	want := []Inline{
+		Text{Text: "See "},
+		Link{Href: "/title/Pacman", Kind: LinkWiki, Target: "Pacman", Inlines: []Inline{Emphasis{Inlines: []Inline{Text{Text: "pacman"}}}}},
+		Text{Text: " and "},
+		Strong{Inlines: []Inline{Text{Text: "note"}}},
+		LineBreak{},
+		Text{Text: "next"},
+	}
+	if len(doc.Blocks) != 1 {
+		t.Fatalf("Expected one block, got %d", len(doc.Blocks))
+	}
+	para, ok := doc.Blocks[0].(Paragraph)
+	if !ok {
+		t.Fatalf("Expected paragraph, got %T", doc.Blocks[0])
+	}
+	if !reflect.DeepEqual(para.Inlines, want) {
+		t.Errorf("Paragraph inlines = %#v, want %#v", para.Inlines, want)
+	}
+}
+
+func TestWalkSections(t *testing.T) {
+	doc := parseTestDocument(t, `<h2>A</h2><h3>B</h3><h4>C</h4><h3>D</h3><h2>E</h2>`)
+
+	var got []string
+	doc.WalkSections(func(path []string, s *Section) {
+		got = append(got, strings.Join(path, " > "))
+	})
+	want := []string{"A", "A > B", "A > B > C", "A > D", "E"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkSections() paths = %v, want %v", got, want)
+	}
+}
+
+func TestRenderPlainText(t *testing.T) {
+	doc := parseTestDocument(t, `
+		<p>Arch uses <a href="/title/Pacman">pacman</a>.<sup class="reference"><a href="#cite_note-1">[1]</a></sup></p>
+		<h2 id="Usage">Usage</h2>
+		<pre># pacman -Syu</pre>
+		<table><tr><th>Flag</th><th>Meaning</th></tr><tr><td><code>-S</code></td><td>sync</td></tr></table>
+		<ol class="references"><li id="cite_note-1"><span class="reference-text">Pacman homepage</span></li></ol>`)
+
+	want := "Arch uses pacman.[1]\n\nUsage\n\n# pacman -Syu\n\nFlag\tMeaning\n-S\tsync\n\n[1] Pacman homepage"
+	if got := RenderPlainText(doc); got != want {
+		t.Errorf("RenderPlainText() =\n%s\nwant\n%s", got, want)
+	}
+}
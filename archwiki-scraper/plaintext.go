@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func RenderPlainText(doc *Document) string {
+	var parts []string
+	if doc.Title != "" {
+		parts = append(parts, doc.Title)
+	}
+	if blocks := plainBlocks(doc.Blocks); blocks != "" {
+		parts = append(parts, blocks)
+	}
+	doc.WalkSections(func(path []string, s *Section) {
+		parts = append(parts, s.Title)
+		if blocks := plainBlocks(s.Blocks); blocks != "" {
+			parts = append(parts, blocks)
+		}
+	})
+	for _, footnote := range doc.Footnotes {
+		parts = append(parts, fmt.Sprintf("[%s] %s", footnote.Label, strings.TrimSpace(plainInlines(footnote.Inlines))))
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
+}
+
+func plainBlocks(blocks []Block) string {
+	var parts []string
+	for _, block := range blocks {
+		if text := plainBlock(block); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func plainBlock(block Block) string {
+	switch b := block.(type) {
+	case Paragraph:
+		return strings.TrimSpace(plainInlines(b.Inlines))
+	case List:
+		var items []string
+		for i, item := range b.Items {
+			prefix := "- "
+			if b.Ordered {
+				prefix = fmt.Sprintf("%d. ", i+1)
+			}
+			pad := strings.Repeat(" ", len(prefix))
+			items = append(items, prefix+strings.TrimPrefix(indentLines(plainBlocks(item.Blocks), pad), pad))
+		}
+		return strings.Join(items, "\n")
+	case DefinitionList:
+		var items []string
+		for _, item := range b.Items {
+			body := plainBlocks(item.Blocks)
+			if term := strings.TrimSpace(plainInlines(item.Term)); term != "" {
+				body = strings.TrimSpace(term + ": " + body)
+			}
+			items = append(items, body)
+		}
+		return strings.Join(items, "\n")
+	case Table:
+		var rows []string
+		for _, row := range b.Rows {
+			cells := make([]string, len(row))
+			for j, cell := range row {
+				if cell != nil && (j == 0 || cell != row[j-1]) {
+					cells[j] = strings.ReplaceAll(plainBlocks(cell.Blocks), "\n", " ")
+				}
+			}
+			if strings.Join(cells, "") == "" {
+				continue
+			}
+			rows = append(rows, strings.Join(cells, "\t"))
+		}
+		return strings.Join(rows, "\n")
+	case CodeBlock:
+		if b.Caption != "" {
+			return b.Caption + "\n" + b.Code
+		}
+		return b.Code
+	case Admonition:
+		kind := strings.ToUpper(b.Kind[:1]) + b.Kind[1:]
+		return kind + ": " + plainBlocks(b.Blocks)
+	case Quote:
+		return plainBlocks(b.Blocks)
+	case Figure:
+		if caption := strings.TrimSpace(plainInlines(b.Caption)); caption != "" {
+			return caption
+		}
+		return b.Image.Alt
+	case RawHTML:
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(b.HTML))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(collapseWhitespace(doc.Text()))
+	}
+	return ""
+}
+
+func plainInlines(inlines []Inline) string {
+	var result strings.Builder
+	for _, inline := range inlines {
+		switch in := inline.(type) {
+		case Text:
+			result.WriteString(in.Text)
+		case Code:
+			result.WriteString(in.Text)
+		case Emphasis:
+			result.WriteString(plainInlines(in.Inlines))
+		case Strong:
+			result.WriteString(plainInlines(in.Inlines))
+		case Link:
+			result.WriteString(in.displayText(plainInlines(in.Inlines)))
+		case Image:
+			result.WriteString(in.Alt)
+		case FootnoteRef:
+			result.WriteString("[" + in.Label + "]")
+		case LineBreak:
+			result.WriteString("\n")
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kyeb/archwiki-scraper/wikipath"
+)
+
+// Wiki paths are page titles as they appear in URL paths after /title/,
+// unescaped and with underscores for spaces.
+var (
+	redirects     = make(map[string]string) // map[alias]canonical
+	savedPages    = make(map[string]string) // map[canonical]filename
+	redirectMutex sync.RWMutex
+)
+
+func wikiPathFromURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || !strings.HasPrefix(u.Path, "/title/") {
+		return ""
+	}
+	return wikipath.Normalize(strings.TrimPrefix(u.Path, "/title/"))
+}
+
+func recordRedirect(alias, canonical string) {
+	redirectMutex.Lock()
+	defer redirectMutex.Unlock()
+	redirects[alias] = canonical
+}
+
+// resolveRedirect unescapes a wiki path taken from a link and returns the
+// canonical path if it is a known alias.
+func resolveRedirect(wikiPath string) string {
+	if unescaped, err := url.PathUnescape(wikiPath); err == nil {
+		wikiPath = wikipath.Normalize(unescaped)
+	}
+	redirectMutex.RLock()
+	defer redirectMutex.RUnlock()
+	if canonical, ok := redirects[wikiPath]; ok {
+		return canonical
+	}
+	return wikiPath
+}
+
+// claimPage reserves filename for an article and reports whether this is the
+// first time the article has been seen, so that an article reached through
+// several aliases is only saved once.
+func claimPage(canonical, filename string) bool {
+	redirectMutex.Lock()
+	defer redirectMutex.Unlock()
+	if _, exists := savedPages[canonical]; exists {
+		return false
+	}
+	savedPages[canonical] = filename
+	return true
+}
+
+func pageAliases(canonical string) []string {
+	redirectMutex.RLock()
+	defer redirectMutex.RUnlock()
+	var aliases []string
+	for alias, target := range redirects {
+		if target == canonical {
+			aliases = append(aliases, strings.ReplaceAll(alias, "_", " "))
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
+
+// settlePageFiles renames the files of titles that turned out to collide with
+// another title, once every title is known, so that file names do not depend
+// on the order pages were saved in.
+func settlePageFiles() error {
+	renamed := pageFiles.Settle()
+	if len(renamed) == 0 {
+		return nil
+	}
+	ext := formatExtension(*outputFormat)
+
+	redirectMutex.Lock()
+	defer redirectMutex.Unlock()
+	for canonical, filename := range savedPages {
+		name, ok := renamed[strings.TrimSuffix(filepath.Base(filename), ext)]
+		if !ok {
+			continue
+		}
+		settled := filepath.Join(filepath.Dir(filename), name+ext)
+		if err := os.Rename(filename, settled); err != nil {
+			return err
+		}
+		savedPages[canonical] = settled
+	}
+
+	recordsMutex.Lock()
+	defer recordsMutex.Unlock()
+	for pageURL, record := range pageRecords {
+		if name, ok := renamed[strings.TrimSuffix(record.File, ext)]; ok {
+			record.File = name + ext
+			pageRecords[pageURL] = record
+		}
+	}
+	return nil
+}
+
+// finalizeLinks updates saved markdown pages once the crawl has finished,
+// since a redirect or a file name collision can be discovered after the pages
+// affected by it were written: canonical pages get their full alias list and
+// links are pointed at the file each page was actually saved as.
+func finalizeLinks() error {
+	redirectMutex.RLock()
+	pages := make(map[string]string, len(savedPages))
+	for canonical, filename := range savedPages {
+		pages[canonical] = filename
+	}
+	aliasCount := len(redirects)
+	redirectMutex.RUnlock()
+
+	if aliasCount == 0 && len(pageFiles.Renamed()) == 0 {
+		return nil
+	}
+	for canonical, filename := range pages {
+		if err := rewritePageLinks(filename, pageAliases(canonical)); err != nil {
+			return fmt.Errorf("failed to update links in %s: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+func rewritePageLinks(filename string, aliases []string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	meta, body, err := parseFrontMatter(string(data))
+	if err != nil {
+		return err
+	}
+
+	rewritten := rewriteLinkTargets(body)
+	if rewritten == body && slices.Equal(aliases, meta.Aliases) {
+		return nil
+	}
+
+	meta.Aliases = aliases
+	meta.ContentHash = contentHash(rewritten)
+	meta.Sections = locateSections(meta.Sections, rewritten)
+	frontMatter, err := renderFrontMatter(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(frontMatter+"\n"+rewritten), 0644)
+}
+
+// rewriteLinkTargets points links that convertWikiLinks produced before a
+// redirect or a renamed file was known at the right file.
+func rewriteLinkTargets(content string) string {
+	replacements := make(map[string]string)
+	for _, title := range pageFiles.Renamed() {
+		replacements[wikipath.Encode(title)+".md"] = wikiLinkPath(title)
+	}
+	redirectMutex.RLock()
+	for alias, canonical := range redirects {
+		replacements[wikiLinkPath(alias)] = wikiLinkPath(canonical)
+	}
+	redirectMutex.RUnlock()
+
+	rewrite := func(target string) string {
+		file, anchor, found := strings.Cut(target, "#")
+		replacement, ok := replacements[file]
+		if !ok {
+			return target
+		}
+		if found {
+			replacement += "#" + anchor
+		}
+		return replacement
+	}
+	return mapHTMLLinks(mapLinkTargets(content, rewrite), rewrite)
+}
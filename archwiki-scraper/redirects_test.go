@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kyeb/archwiki-scraper/wikipath"
+	"gopkg.in/yaml.v3"
+)
+
+func resetRedirects(t *testing.T) {
+	t.Helper()
+	dir := outputDir
+	t.Cleanup(func() {
+		outputDir = dir
+		redirects = make(map[string]string)
+		savedPages = make(map[string]string)
+		pageFiles = wikipath.NewManifest()
+	})
+	redirects = make(map[string]string)
+	savedPages = make(map[string]string)
+	pageFiles = wikipath.NewManifest()
+}
+
+func TestConvertWikiLinksRedirect(t *testing.T) {
+	resetRedirects(t)
+	outputDir = "output"
+	recordRedirect("AUR", "Arch_User_Repository")
+	recordRedirect("Café", "Coffee")
+
+	got := convertWikiLinks("See [AUR](/title/AUR#Installing_packages), [café](/title/Caf%C3%A9) and [pacman](/title/Pacman).")
+	want := "See [AUR](Arch_User_Repository.md#Installing_packages), [café](Coffee.md) and [pacman](Pacman.md)."
+	if got != want {
+		t.Errorf("convertWikiLinks() = %q, want %q", got, want)
+	}
+}
+
+func TestClaimPage(t *testing.T) {
+	resetRedirects(t)
+	if !claimPage("Arch_User_Repository", "output/Arch_User_Repository.md") {
+		t.Error("first claim should succeed")
+	}
+	if claimPage("Arch_User_Repository", "output/Arch_User_Repository.md") {
+		t.Error("second claim should fail")
+	}
+}
+
+func TestFinalizeLinks(t *testing.T) {
+	resetRedirects(t)
+	outputDir = t.TempDir()
+
+	save := func(name, html string) string {
+		filename := urlToFilename(baseURL + "/title/" + name)
+		if !claimPage(name, filename) {
+			t.Fatalf("claimPage(%s) failed", name)
+		}
+		if err := savePage(filename, parseTestDocument(t, html), PageMeta{Title: name}); err != nil {
+			t.Fatalf("savePage(%s) error = %v", name, err)
+		}
+		return filename
+	}
+	repo := save("Arch_User_Repository", `<p>The AUR.</p>`)
+	lower := save("Pkgbuild", `<p>Lower case.</p>`)
+	linking := save("Makepkg", `<p>Build <a href="/title/PKGBUILD">PKGBUILD</a>s and <a href="/title/Pkgbuild">pkgbuilds</a> from the <a href="/title/AUR#Getting_started">AUR</a> or <a href="/title/AUR_(Espa%C3%B1ol)">AUR (Español)</a>.</p><table><tr><td><table><tr><td><a href="/title/AUR">AUR</a></td></tr></table></td></tr></table><h2 id="Usage">Usage</h2><p>Run it.</p>`)
+	collided := save("PKGBUILD", `<p>Upper case.</p>`)
+
+	// The redirect and the collision are only discovered after the linking
+	// page was written.
+	recordRedirect("AUR", "Arch_User_Repository")
+	recordRedirect("AUR_(Español)", "Arch_User_Repository_(Español)")
+	defer func(records map[string]PageRecord) { pageRecords = records }(pageRecords)
+	pageRecords = map[string]PageRecord{baseURL + "/title/Pkgbuild": {File: filepath.Base(lower)}}
+	if err := settlePageFiles(); err != nil {
+		t.Fatalf("settlePageFiles() error = %v", err)
+	}
+	if _, err := os.Stat(lower); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be renamed once its title collided", lower)
+	}
+	settled := savedPages["Pkgbuild"]
+	if _, err := os.Stat(settled); err != nil || settled == lower {
+		t.Errorf("savedPages[Pkgbuild] = %s, want the renamed file", settled)
+	}
+	if record := pageRecords[baseURL+"/title/Pkgbuild"]; record.File != filepath.Base(settled) {
+		t.Errorf("manifest record file = %s, want %s", record.File, filepath.Base(settled))
+	}
+	if err := finalizeLinks(); err != nil {
+		t.Fatalf("finalizeLinks() error = %v", err)
+	}
+
+	repoMeta, _ := readSavedPage(t, repo)
+	if want := []string{"AUR"}; !reflect.DeepEqual(repoMeta.Aliases, want) {
+		t.Errorf("Aliases = %v, want %v", repoMeta.Aliases, want)
+	}
+
+	meta, body := readSavedPage(t, linking)
+	if !strings.Contains(body, "[AUR](Arch_User_Repository.md#Getting_started)") {
+		t.Errorf("expected alias link to be rewritten:\n%s", body)
+	}
+	if link := "[PKGBUILD](" + filepath.Base(collided) + ")"; !strings.Contains(body, link) || filepath.Base(collided) == "PKGBUILD.md" {
+		t.Errorf("expected link to renamed file %s:\n%s", collided, body)
+	}
+	if link := "[pkgbuilds](" + filepath.Base(settled) + ")"; !strings.Contains(body, link) {
+		t.Errorf("expected link to settled file %s:\n%s", settled, body)
+	}
+	if link := "[AUR (Español)](Arch_User_Repository_~28Español~29.md)"; !strings.Contains(body, link) {
+		t.Errorf("expected parenthesised alias link to be rewritten:\n%s", body)
+	}
+	if !strings.Contains(body, `<a href="Arch_User_Repository.md">AUR</a>`) {
+		t.Errorf("expected alias link in raw HTML to be rewritten:\n%s", body)
+	}
+	if meta.ContentHash != contentHash(body) {
+		t.Errorf("content hash not updated after rewriting links")
+	}
+	if len(meta.Sections) != 1 || !strings.HasPrefix(string([]rune(body)[meta.Sections[0].Offset:]), "## Usage") {
+		t.Errorf("section offsets not updated: %+v", meta.Sections)
+	}
+}
+
+func readSavedPage(t *testing.T, filename string) (PageMeta, string) {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontMatter, body, found := strings.Cut(strings.TrimPrefix(string(data), "---\n"), "\n---\n\n")
+	if !found {
+		t.Fatalf("missing front matter in %s", filename)
+	}
+	var meta PageMeta
+	if err := yaml.Unmarshal([]byte(frontMatter), &meta); err != nil {
+		t.Fatal(err)
+	}
+	return meta, body
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var footnoteLabelUnsafe = regexp.MustCompile(`[^\w-]+`)
+
+func parseFootnoteRef(s *goquery.Selection) Inline {
+	href, _ := s.Find("a").First().Attr("href")
+	label := footnoteLabel(strings.TrimPrefix(href, "#"))
+	if label == "" {
+		return nil
+	}
+	return FootnoteRef{Label: label}
+}
+
+func parseReferences(s *goquery.Selection) []Footnote {
+	list := s
+	if !s.Is("ol.references") {
+		if !s.Is("div.mw-references-wrap, div.reflist") {
+			return nil
+		}
+		list = s.Find("ol.references")
+	}
+
+	var footnotes []Footnote
+	list.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+		label := footnoteLabel(li.AttrOr("id", ""))
+		if label == "" {
+			return
+		}
+		text := li.Find("span.reference-text")
+		if text.Length() == 0 {
+			text = li.Clone().Find(".mw-cite-backlink").Remove().End()
+		}
+		inlines := parseInlines(text)
+		if inlinesEmpty(inlines) {
+			return
+		}
+		footnotes = append(footnotes, Footnote{Label: label, Inlines: inlines})
+	})
+
+	return footnotes
+}
+
+func footnoteLabel(id string) string {
+	label := strings.TrimPrefix(id, "cite_note-")
+	return strings.Trim(footnoteLabelUnsafe.ReplaceAllString(label, "-"), "-")
+}
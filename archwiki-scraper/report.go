@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	runReportFile  = "run_report.json"
+	runSummaryFile = "run_report.txt"
+)
+
+// RunReport summarises a crawl. Fetched counts successful responses, each of
+// which is then saved, skipped as empty, skipped as a duplicate of a page
+// already saved under another URL, or has no article content at all. Latency
+// is measured up to the response headers. BytesWritten counts converted pages
+// as first saved.
+type RunReport struct {
+	StartedAt         time.Time         `json:"started_at"`
+	FinishedAt        time.Time         `json:"finished_at"`
+	ElapsedSeconds    float64           `json:"elapsed_seconds"`
+	PagesFetched      int               `json:"pages_fetched"`
+	PagesSaved        int               `json:"pages_saved"`
+	PagesSkippedEmpty int               `json:"pages_skipped_empty"`
+	PagesDuplicate    int               `json:"pages_duplicate"`
+	PagesErrored      int               `json:"pages_errored"`
+	ErrorsByStatus    map[string]int    `json:"errors_by_status,omitempty"`
+	BytesDownloaded   int64             `json:"bytes_downloaded"`
+	BytesWritten      int64             `json:"bytes_written"`
+	AverageLatencyMS  float64           `json:"average_latency_ms"`
+	Depths            []DepthStats      `json:"depths"`
+	Seeds             []string          `json:"seeds"`
+	Config            map[string]string `json:"config"`
+}
+
+type DepthStats struct {
+	Depth        int `json:"depth"`
+	Fetched      int `json:"fetched"`
+	Saved        int `json:"saved"`
+	SkippedEmpty int `json:"skipped_empty"`
+}
+
+// crawlStats collects the counts for the run report while the crawl runs and
+// keeps the Prometheus metrics up to date.
+type crawlStats struct {
+	mu         sync.Mutex
+	started    time.Time
+	report     RunReport
+	depths     map[int]*DepthStats
+	latency    time.Duration
+	responses  int
+	depth      int
+	queueDepth int
+}
+
+// stats counts the crawl. It is created once, at startup, and only updated
+// through its methods, since the metrics server reads it while the crawl runs.
+var stats = newCrawlStats()
+
+func newCrawlStats() *crawlStats {
+	return &crawlStats{
+		started: time.Now(),
+		report:  RunReport{ErrorsByStatus: make(map[string]int)},
+		depths:  make(map[int]*DepthStats),
+	}
+}
+
+func (s *crawlStats) depthStats(depth int) *DepthStats {
+	d, ok := s.depths[depth]
+	if !ok {
+		d = &DepthStats{Depth: depth}
+		s.depths[depth] = d
+	}
+	return d
+}
+
+func (s *crawlStats) fetched(depth int, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.PagesFetched++
+	s.report.BytesDownloaded += int64(bytes)
+	s.depthStats(depth).Fetched++
+	pagesFetchedCounter.Inc()
+}
+
+func (s *crawlStats) saved(depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.PagesSaved++
+	s.depthStats(depth).Saved++
+	pagesSavedCounter.Inc()
+}
+
+func (s *crawlStats) skippedEmpty(depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.PagesSkippedEmpty++
+	s.depthStats(depth).SkippedEmpty++
+}
+
+func (s *crawlStats) duplicate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.PagesDuplicate++
+}
+
+// errored counts a failed request. status is 0 when no response was
+// received.
+func (s *crawlStats) errored(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.PagesErrored++
+	key := strconv.Itoa(status)
+	if status == 0 {
+		key = "network"
+	}
+	s.report.ErrorsByStatus[key]++
+	requestErrorsCounter.WithLabelValues(key).Inc()
+}
+
+func (s *crawlStats) wrote(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report.BytesWritten += int64(bytes)
+	bytesWrittenCounter.Add(float64(bytes))
+}
+
+func (s *crawlStats) converted(duration time.Duration) {
+	conversionDuration.Observe(duration.Seconds())
+}
+
+// startDepth notes that the pages of a new depth are about to be fetched.
+func (s *crawlStats) startDepth(depth, pages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.depth, s.queueDepth = depth, pages
+	crawlDepthGauge.Set(float64(depth))
+	queueDepthGauge.Set(float64(pages))
+}
+
+// done notes that a page of the current depth has been fully processed.
+func (s *crawlStats) done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queueDepth > 0 {
+		s.queueDepth--
+	}
+	queueDepthGauge.Set(float64(s.queueDepth))
+}
+
+func (s *crawlStats) status() crawlStatus {
+	report := s.snapshot()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := crawlStatus{RunReport: report, Depth: s.depth, QueueDepth: s.queueDepth}
+	if report.ElapsedSeconds > 0 {
+		status.PagesPerSecond = float64(report.PagesFetched) / report.ElapsedSeconds
+	}
+	return status
+}
+
+func (s *crawlStats) roundTrip(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency += latency
+	s.responses++
+}
+
+// snapshot returns the report as it stands, with elapsed time measured to
+// now.
+func (s *crawlStats) snapshot() RunReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := s.report
+	report.StartedAt = s.started.Truncate(time.Second)
+	report.FinishedAt = time.Now().Truncate(time.Second)
+	report.ElapsedSeconds = time.Since(s.started).Seconds()
+	if s.responses > 0 {
+		report.AverageLatencyMS = float64(s.latency.Microseconds()) / 1000 / float64(s.responses)
+	}
+	report.ErrorsByStatus = make(map[string]int, len(s.report.ErrorsByStatus))
+	for status, count := range s.report.ErrorsByStatus {
+		report.ErrorsByStatus[status] = count
+	}
+	report.Depths = []DepthStats{}
+	for _, d := range s.depths {
+		report.Depths = append(report.Depths, *d)
+	}
+	sort.Slice(report.Depths, func(i, j int) bool { return report.Depths[i].Depth < report.Depths[j].Depth })
+	return report
+}
+
+// timedTransport records the latency of every request made through it.
+type timedTransport struct {
+	http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil {
+		stats.roundTrip(time.Since(start))
+	}
+	return resp, err
+}
+
+// flagConfig returns the value of every flag of fs, including defaults.
+func flagConfig(fs *flag.FlagSet) map[string]string {
+	config := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		config[f.Name] = f.Value.String()
+	})
+	return config
+}
+
+// writeRunReport writes the report as JSON and as a table to dir.
+func writeRunReport(dir string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, runReportFile), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, runSummaryFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeRunSummary(f, report); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeRunSummary(w io.Writer, report RunReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	elapsed := time.Duration(report.ElapsedSeconds * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(tw, "Elapsed\t%s\n", elapsed)
+	fmt.Fprintf(tw, "Pages fetched\t%d\n", report.PagesFetched)
+	fmt.Fprintf(tw, "Pages saved\t%d\n", report.PagesSaved)
+	fmt.Fprintf(tw, "Pages skipped (empty)\t%d\n", report.PagesSkippedEmpty)
+	fmt.Fprintf(tw, "Pages skipped (duplicate)\t%d\n", report.PagesDuplicate)
+	fmt.Fprintf(tw, "Pages errored\t%d\n", report.PagesErrored)
+	var statuses []string
+	for status := range report.ErrorsByStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "  status %s\t%d\n", status, report.ErrorsByStatus[status])
+	}
+	fmt.Fprintf(tw, "Bytes downloaded\t%d\n", report.BytesDownloaded)
+	fmt.Fprintf(tw, "Bytes written\t%d\n", report.BytesWritten)
+	fmt.Fprintf(tw, "Average latency\t%.1f ms\n", report.AverageLatencyMS)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "Depth\tFetched\tSaved\tEmpty")
+	for _, d := range report.Depths {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\n", d.Depth, d.Fetched, d.Saved, d.SkippedEmpty)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "Setting\tValue")
+	for _, seed := range report.Seeds {
+		fmt.Fprintf(tw, "seed\t%s\n", seed)
+	}
+	var names []string
+	for name := range report.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", name, report.Config[name])
+	}
+	return tw.Flush()
+}
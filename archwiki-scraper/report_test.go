@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlStats(t *testing.T) {
+	s := newCrawlStats()
+	s.fetched(0, 1000)
+	s.saved(0)
+	s.fetched(1, 500)
+	s.fetched(1, 250)
+	s.saved(1)
+	s.skippedEmpty(1)
+	s.duplicate()
+	s.errored(404)
+	s.errored(0)
+	s.roundTrip(100 * time.Millisecond)
+	s.roundTrip(300 * time.Millisecond)
+
+	report := s.snapshot()
+	if report.PagesFetched != 3 || report.PagesSaved != 2 || report.PagesSkippedEmpty != 1 ||
+		report.PagesDuplicate != 1 || report.PagesErrored != 2 || report.BytesDownloaded != 1750 {
+		t.Errorf("snapshot() counts = %+v", report)
+	}
+	if report.AverageLatencyMS != 200 {
+		t.Errorf("AverageLatencyMS = %v, want 200", report.AverageLatencyMS)
+	}
+	if want := map[string]int{"404": 1, "network": 1}; !reflect.DeepEqual(report.ErrorsByStatus, want) {
+		t.Errorf("ErrorsByStatus = %v, want %v", report.ErrorsByStatus, want)
+	}
+	want := []DepthStats{{Depth: 0, Fetched: 1, Saved: 1}, {Depth: 1, Fetched: 2, Saved: 1, SkippedEmpty: 1}}
+	if !reflect.DeepEqual(report.Depths, want) {
+		t.Errorf("Depths = %+v, want %+v", report.Depths, want)
+	}
+}
+
+func TestWriteRunReport(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("depth", 100, "")
+	fs.String("format", "markdown", "")
+	fs.Parse([]string{"-depth", "2"})
+
+	report := RunReport{
+		ElapsedSeconds: 75,
+		PagesFetched:   3,
+		PagesErrored:   1,
+		ErrorsByStatus: map[string]int{"404": 1},
+		Depths:         []DepthStats{{Depth: 0, Fetched: 1, Saved: 1}},
+		Seeds:          []string{"https://wiki.archlinux.org/title/Arch_Linux"},
+		Config:         flagConfig(fs),
+	}
+	dir := t.TempDir()
+	if err := writeRunReport(dir, report); err != nil {
+		t.Fatalf("writeRunReport() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, runReportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got RunReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, report) {
+		t.Errorf("JSON report = %+v, want %+v", got, report)
+	}
+
+	summary, err := os.ReadFile(filepath.Join(dir, runSummaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compare with columns collapsed to single spaces.
+	var lines []string
+	for _, line := range strings.Split(string(summary), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	for _, want := range []string{
+		"Elapsed 1m15s",
+		"Pages fetched 3",
+		"status 404 1",
+		"Depth Fetched Saved Empty",
+		"0 1 1 0",
+		"seed https://wiki.archlinux.org/title/Arch_Linux",
+		"depth 2",
+		"format markdown",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
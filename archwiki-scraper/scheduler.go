@@ -0,0 +1,235 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Candidate is a discovered page waiting for the next depth to be scheduled.
+// Parent is the page that links to it first in fetch order. Inlinks counts
+// the fetched pages linking to it and CategoryLinks those of them that share a
+// category with a seed page.
+type Candidate struct {
+	URL           string
+	Parent        string
+	Inlinks       int
+	CategoryLinks int
+
+	order   [2]int // position of Parent in its depth, position of the link on Parent
+	sources map[string]bool
+}
+
+// PriorityFunc scores a candidate. Candidates with higher scores are fetched,
+// and so claim a place under the max-files limit, first.
+type PriorityFunc func(c *Candidate) float64
+
+var priorityFuncs = map[string]PriorityFunc{
+	"bfs":      nil,
+	"inlinks":  func(c *Candidate) float64 { return float64(c.Inlinks) },
+	"category": func(c *Candidate) float64 { return float64(c.CategoryLinks) },
+}
+
+type scheduledPage struct {
+	depth    int
+	position int
+	parent   string
+}
+
+// Scheduler decides which pages are fetched, one depth at a time. The pages
+// of the next depth are only chosen once the current depth has been fully
+// processed, and candidates are ordered by priority and then by where they
+// were first linked from, so a crawl with the same limits always selects the
+// same pages however its requests interleave.
+type Scheduler struct {
+	maxDepth int
+	maxFiles int
+	priority PriorityFunc
+
+	// OnSkip is called for each candidate left out by the depth or file limit.
+	OnSkip func(c *Candidate, reason string)
+
+	mu         sync.Mutex
+	depth      int
+	admitted   int
+	pages      map[string]scheduledPage
+	level      map[string]int // map[url]position in the current depth
+	candidates map[string]*Candidate
+	categories map[string][]string
+}
+
+func NewScheduler(maxDepth, maxFiles int, priority PriorityFunc) *Scheduler {
+	return &Scheduler{
+		maxDepth:   maxDepth,
+		maxFiles:   maxFiles,
+		priority:   priority,
+		depth:      -1,
+		pages:      make(map[string]scheduledPage),
+		level:      make(map[string]int),
+		candidates: make(map[string]*Candidate),
+		categories: make(map[string][]string),
+	}
+}
+
+// Seed adds start pages, which are fetched at depth 0 in the order given.
+func (s *Scheduler) Seed(urls ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, u := range urls {
+		if _, ok := s.candidates[u]; !ok {
+			s.candidates[u] = &Candidate{URL: u, order: [2]int{-1, i}, sources: make(map[string]bool)}
+		}
+	}
+}
+
+// Discover records a link from a page of the current depth. position is the
+// index of the link among the page's crawlable links.
+func (s *Scheduler) Discover(parent string, position int, linkURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pages[linkURL]; ok {
+		return
+	}
+	parentPosition, ok := s.level[parent]
+	if !ok {
+		return
+	}
+	order := [2]int{parentPosition, position}
+	c, ok := s.candidates[linkURL]
+	if !ok {
+		c = &Candidate{URL: linkURL, Parent: parent, order: order, sources: make(map[string]bool)}
+		s.candidates[linkURL] = c
+	} else if orderLess(order, c.order) {
+		c.Parent, c.order = parent, order
+	}
+	c.sources[parent] = true
+}
+
+// Alias marks canonicalURL as fetched along with requestURL, which redirected
+// to it, so links to either are not followed again and links found on the
+// page can be discovered under either URL. When several URLs of a depth lead
+// to the same page, its links are ordered from the earliest of them.
+func (s *Scheduler) Alias(requestURL, canonicalURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if page, ok := s.pages[requestURL]; ok {
+		if _, exists := s.pages[canonicalURL]; !exists {
+			s.pages[canonicalURL] = page
+		}
+		if position, ok := s.level[requestURL]; ok {
+			if current, exists := s.level[canonicalURL]; !exists || position < current {
+				s.level[canonicalURL] = position
+			}
+		}
+		delete(s.candidates, canonicalURL)
+	}
+}
+
+// SetCategories records the categories of a fetched page for the category
+// priority.
+func (s *Scheduler) SetCategories(pageURL string, categories []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories[pageURL] = categories
+}
+
+// Page returns the depth a page was scheduled at and the page it was first
+// linked from.
+func (s *Scheduler) Page(pageURL string) (depth int, parent string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, ok := s.pages[pageURL]
+	return page.depth, page.parent, ok
+}
+
+// Rank returns the depth a page was scheduled at and its position in that
+// depth, which order pages the way the scheduler fetches them.
+func (s *Scheduler) Rank(pageURL string) [2]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := s.pages[pageURL]
+	return [2]int{page.depth, page.position}
+}
+
+func (s *Scheduler) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Next returns the pages to fetch at the next depth in fetch order, or nil
+// once there is nothing left to fetch. It must only be called after every
+// page returned by the previous call has been processed.
+func (s *Scheduler) Next() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seedCategories := make(map[string]bool)
+	for u, page := range s.pages {
+		if page.depth == 0 {
+			for _, category := range s.categories[u] {
+				seedCategories[category] = true
+			}
+		}
+	}
+
+	candidates := make([]*Candidate, 0, len(s.candidates))
+	scores := make(map[*Candidate]float64, len(s.candidates))
+	for _, c := range s.candidates {
+		c.Inlinks = len(c.sources)
+		c.CategoryLinks = 0
+		for source := range c.sources {
+			for _, category := range s.categories[source] {
+				if seedCategories[category] {
+					c.CategoryLinks++
+					break
+				}
+			}
+		}
+		if s.priority != nil {
+			scores[c] = s.priority(c)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		if a.order != b.order {
+			return orderLess(a.order, b.order)
+		}
+		return a.URL < b.URL
+	})
+
+	depth := s.depth + 1
+	s.candidates = make(map[string]*Candidate)
+	s.level = make(map[string]int)
+	var batch []string
+	for _, c := range candidates {
+		switch {
+		case depth > s.maxDepth:
+			s.skip(c, skipDepth)
+		case s.admitted >= s.maxFiles:
+			s.skip(c, skipMaxFiles)
+		default:
+			s.pages[c.URL] = scheduledPage{depth: depth, position: len(batch), parent: c.Parent}
+			s.level[c.URL] = len(batch)
+			batch = append(batch, c.URL)
+			s.admitted++
+		}
+	}
+	if len(batch) > 0 {
+		s.depth = depth
+	}
+	return batch
+}
+
+func (s *Scheduler) skip(c *Candidate, reason string) {
+	if s.OnSkip != nil {
+		s.OnSkip(c, reason)
+	}
+}
+
+func orderLess(a, b [2]int) bool {
+	return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+}
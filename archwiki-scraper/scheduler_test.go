@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// crawl runs the scheduler over a fixed link graph, processing the pages of
+// each depth in reverse to show that completion order does not matter.
+func crawl(s *Scheduler, links map[string][]string, categories map[string][]string) [][]string {
+	var batches [][]string
+	for batch := s.Next(); len(batch) > 0; batch = s.Next() {
+		batches = append(batches, batch)
+		for i := len(batch) - 1; i >= 0; i-- {
+			page := batch[i]
+			s.SetCategories(page, categories[page])
+			for position, link := range links[page] {
+				s.Discover(page, position, link)
+			}
+		}
+	}
+	return batches
+}
+
+func TestScheduler(t *testing.T) {
+	links := map[string][]string{
+		"A": {"B", "C", "D"},
+		"B": {"E", "A", "F", "G"},
+		"C": {"F", "G", "E"},
+		"D": {"G"},
+	}
+	categories := map[string][]string{
+		"A": {"Networking"},
+		"C": {"Networking"},
+		"D": {"Networking"},
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		maxFiles int
+		priority string
+		want     [][]string
+		skipped  map[string]string
+	}{
+		{
+			name:     "breadth first",
+			maxDepth: 10,
+			maxFiles: 100,
+			priority: "bfs",
+			want:     [][]string{{"A"}, {"B", "C", "D"}, {"E", "F", "G"}},
+		},
+		{
+			name:     "max files",
+			maxDepth: 10,
+			maxFiles: 5,
+			priority: "bfs",
+			want:     [][]string{{"A"}, {"B", "C", "D"}, {"E"}},
+			skipped:  map[string]string{"F": skipMaxFiles, "G": skipMaxFiles},
+		},
+		{
+			name:     "max depth",
+			maxDepth: 1,
+			maxFiles: 100,
+			priority: "bfs",
+			want:     [][]string{{"A"}, {"B", "C", "D"}},
+			skipped:  map[string]string{"E": skipDepth, "F": skipDepth, "G": skipDepth},
+		},
+		{
+			name:     "inlinks",
+			maxDepth: 10,
+			maxFiles: 5,
+			priority: "inlinks",
+			want:     [][]string{{"A"}, {"B", "C", "D"}, {"G"}},
+			skipped:  map[string]string{"E": skipMaxFiles, "F": skipMaxFiles},
+		},
+		{
+			name:     "category",
+			maxDepth: 10,
+			maxFiles: 6,
+			priority: "category",
+			want:     [][]string{{"A"}, {"B", "C", "D"}, {"G", "E"}},
+			skipped:  map[string]string{"F": skipMaxFiles},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.maxDepth, tt.maxFiles, priorityFuncs[tt.priority])
+			skipped := make(map[string]string)
+			s.OnSkip = func(c *Candidate, reason string) { skipped[c.URL] = reason }
+			s.Seed("A")
+
+			if got := crawl(s, links, categories); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches = %v, want %v", got, tt.want)
+			}
+			if len(skipped) == 0 {
+				skipped = nil
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("skipped = %v, want %v", skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestSchedulerPage(t *testing.T) {
+	s := NewScheduler(10, 100, nil)
+	s.Seed("A")
+	s.Next()
+	s.Discover("A", 0, "B")
+	s.Alias("A", "A2")
+	s.Discover("A", 1, "A2")
+	if got := s.Next(); !reflect.DeepEqual(got, []string{"B"}) {
+		t.Errorf("Next() = %v, want [B]", got)
+	}
+
+	if depth, parent, ok := s.Page("B"); !ok || depth != 1 || parent != "A" {
+		t.Errorf("Page(B) = %d, %q, %v, want 1, \"A\", true", depth, parent, ok)
+	}
+	if depth, _, ok := s.Page("A2"); !ok || depth != 0 {
+		t.Errorf("Page(A2) = %d, %v, want the depth of the page redirecting to it", depth, ok)
+	}
+}
+
+func TestSchedulerAliasOrder(t *testing.T) {
+	s := NewScheduler(10, 100, nil)
+	s.Seed("A", "C", "B")
+	s.Next()
+
+	// A and B both redirect to X. B's response arrives first, but X's links
+	// are ordered from A, which the scheduler placed first.
+	s.Alias("B", "X")
+	s.Discover("X", 0, "L")
+	s.Discover("C", 0, "K")
+	s.Alias("A", "X")
+	s.Discover("X", 0, "L")
+
+	if got, want := s.Next(), []string{"L", "K"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+	if rank := s.Rank("B"); rank != [2]int{0, 2} {
+		t.Errorf("Rank(B) = %v, want [0 2]", rank)
+	}
+	if rank := s.Rank("L"); rank != [2]int{1, 0} {
+		t.Errorf("Rank(L) = %v, want [1 0]", rank)
+	}
+}
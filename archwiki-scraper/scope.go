@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kyeb/archwiki-scraper/wikipath"
+)
+
+// CrawlScope chooses where a crawl starts and which links it follows. Seeds
+// are page titles or URLs. Include and Exclude patterns match page titles
+// with spaces, such as "Network configuration/Wireless": a pattern is a glob
+// matching the whole title unless it starts with "re:", in which case the
+// rest is a regular expression. A link is followed if its title matches an
+// Include pattern, or there are none, and matches no Exclude pattern. When
+// Categories is set the crawl starts from those category pages and only
+// follows their member and subcategory listings.
+type CrawlScope struct {
+	Seeds      []string `json:"seeds"`
+	Include    []string `json:"include"`
+	Exclude    []string `json:"exclude"`
+	Categories []string `json:"categories"`
+}
+
+type scopeMatcher struct {
+	include      []*regexp.Regexp
+	exclude      []*regexp.Regexp
+	categoryMode bool
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func loadCrawlScope(filename string) (CrawlScope, error) {
+	var scope CrawlScope
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return scope, err
+	}
+	if err := json.Unmarshal(data, &scope); err != nil {
+		return scope, fmt.Errorf("failed to parse crawl scope %s: %v", filename, err)
+	}
+	return scope, nil
+}
+
+// readSeedFile returns the seeds listed one per line in filename, ignoring
+// blank lines and lines starting with '#'.
+func readSeedFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			seeds = append(seeds, line)
+		}
+	}
+	return seeds, scanner.Err()
+}
+
+// seedURLs returns the URLs to start the crawl from: every seed, then the
+// page of every category.
+func (s CrawlScope) seedURLs() []string {
+	var urls []string
+	for _, seed := range s.Seeds {
+		urls = append(urls, pageURLFor(seed))
+	}
+	for _, category := range s.Categories {
+		if !strings.HasPrefix(category, "Category:") {
+			category = "Category:" + category
+		}
+		urls = append(urls, pageURLFor(category))
+	}
+	return urls
+}
+
+// pageURLFor returns the URL for a seed given as a URL or a title, escaped
+// the way the wiki escapes its own links.
+func pageURLFor(seed string) string {
+	if strings.HasPrefix(seed, "https://") || strings.HasPrefix(seed, "http://") {
+		return strings.Split(seed, "#")[0]
+	}
+	return baseURL + (&url.URL{Path: "/title/" + wikipath.Normalize(seed)}).EscapedPath()
+}
+
+func compileCrawlScope(s CrawlScope) (*scopeMatcher, error) {
+	m := &scopeMatcher{categoryMode: len(s.Categories) > 0}
+	for _, pattern := range s.Include {
+		re, err := compileTitlePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.include = append(m.include, re)
+	}
+	for _, pattern := range s.Exclude {
+		re, err := compileTitlePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		m.exclude = append(m.exclude, re)
+	}
+	return m, nil
+}
+
+func compileTitlePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		return re, nil
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range strings.ReplaceAll(pattern, "_", " ") {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// allows reports whether links to pageURL may be followed. In category mode
+// Include patterns only apply to articles: category pages are followed unless
+// excluded, so the crawl still reaches the members of subcategories.
+func (m *scopeMatcher) allows(pageURL string) bool {
+	title := strings.ReplaceAll(wikiPathFromURL(pageURL), "_", " ")
+	if title == "" {
+		return false
+	}
+	matches := func(patterns []*regexp.Regexp) bool {
+		for _, re := range patterns {
+			if re.MatchString(title) {
+				return true
+			}
+		}
+		return false
+	}
+	if m.categoryMode && strings.HasPrefix(title, "Category:") {
+		return !matches(m.exclude)
+	}
+	return (len(m.include) == 0 || matches(m.include)) && !matches(m.exclude)
+}
+
+// linkSelector returns the selector for the links to follow from pageURL
+// within div#mw-content-text. In category mode only category pages are
+// followed, through their listings, including the links to the later pages
+// of a long listing.
+func (m *scopeMatcher) linkSelector(pageURL string) string {
+	if !m.categoryMode {
+		return "a[href]"
+	}
+	if strings.HasPrefix(wikiPathFromURL(pageURL), "Category:") {
+		return "#mw-subcategories a[href], #mw-pages a[href]"
+	}
+	return ""
+}
+
+// listingContinuation returns the URL of the next page of a category listing
+// when href links to one, such as
+// /index.php?title=Category:Networking&pagefrom=Wireless#mw-pages. They are
+// only followed in category mode.
+func (m *scopeMatcher) listingContinuation(href string) (string, bool) {
+	if !m.categoryMode {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.Host != "" && u.Host != "wiki.archlinux.org" || u.Path != "/index.php" {
+		return "", false
+	}
+	query := u.Query()
+	if !strings.HasPrefix(query.Get("title"), "Category:") || query.Get("pagefrom") == "" && query.Get("subcatfrom") == "" {
+		return "", false
+	}
+	return baseURL + u.RequestURI(), true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScopeMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   CrawlScope
+		pageURL string
+		want    bool
+	}{
+		{"no patterns", CrawlScope{}, "https://wiki.archlinux.org/title/Pacman", true},
+		{"glob include", CrawlScope{Include: []string{"Network*"}}, "https://wiki.archlinux.org/title/Network_configuration/Wireless", true},
+		{"glob is anchored", CrawlScope{Include: []string{"Network*"}}, "https://wiki.archlinux.org/title/Wireless_network", false},
+		{"glob with underscores", CrawlScope{Include: []string{"Network_configuration"}}, "https://wiki.archlinux.org/title/Network_configuration", true},
+		{"glob question mark", CrawlScope{Include: []string{"Iptable?"}}, "https://wiki.archlinux.org/title/Iptables", true},
+		{"regexp include", CrawlScope{Include: []string{"re:(?i)firewall"}}, "https://wiki.archlinux.org/title/Uncomplicated_Firewall", true},
+		{"exclude wins", CrawlScope{Include: []string{"*"}, Exclude: []string{"*/*"}}, "https://wiki.archlinux.org/title/Network_configuration/Wireless", false},
+		{"escaped title", CrawlScope{Include: []string{"Café"}}, "https://wiki.archlinux.org/title/Caf%C3%A9", true},
+		{"not a wiki page", CrawlScope{}, "https://wiki.archlinux.org/index.php?title=Pacman", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compileCrawlScope(tt.scope)
+			if err != nil {
+				t.Fatalf("compileCrawlScope() error = %v", err)
+			}
+			if got := m.allows(tt.pageURL); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.pageURL, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := compileCrawlScope(CrawlScope{Exclude: []string{"re:("}}); err == nil {
+		t.Error("compileCrawlScope() accepted an invalid regexp")
+	}
+}
+
+func TestCategoryLinkSelector(t *testing.T) {
+	m, err := compileCrawlScope(CrawlScope{Categories: []string{"Networking"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.linkSelector("https://wiki.archlinux.org/title/Category:Networking"); got != "#mw-subcategories a[href], #mw-pages a[href]" {
+		t.Errorf("linkSelector(category) = %q", got)
+	}
+	if got := m.linkSelector("https://wiki.archlinux.org/title/Iptables"); got != "" {
+		t.Errorf("linkSelector(member) = %q, want no links followed", got)
+	}
+}
+
+func TestCategoryModeFollowsSubcategories(t *testing.T) {
+	m, err := compileCrawlScope(CrawlScope{Categories: []string{"Networking"}, Include: []string{"Network*"}, Exclude: []string{"Category:Archive"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pageURL string
+		want    bool
+	}{
+		{"https://wiki.archlinux.org/title/Network_configuration", true},
+		{"https://wiki.archlinux.org/title/Iptables", false},
+		{"https://wiki.archlinux.org/title/Category:Firewalls", true},
+		{"https://wiki.archlinux.org/title/Category:Archive", false},
+	}
+	for _, tt := range tests {
+		if got := m.allows(tt.pageURL); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.pageURL, got, tt.want)
+		}
+	}
+
+	seeds, err := compileCrawlScope(CrawlScope{Seeds: []string{"Networking"}, Include: []string{"Network*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeds.allows("https://wiki.archlinux.org/title/Category:Firewalls") {
+		t.Error("allows(category) = true outside category mode, want include patterns applied")
+	}
+}
+
+func TestListingContinuation(t *testing.T) {
+	tests := []struct {
+		name   string
+		href   string
+		want   string
+		wantOK bool
+	}{
+		{"next page of members", "/index.php?title=Category:Networking&pagefrom=Wireless%0AWireless#mw-pages", "https://wiki.archlinux.org/index.php?title=Category:Networking&pagefrom=Wireless%0AWireless", true},
+		{"next page of subcategories", "/index.php?title=Category:Networking&subcatfrom=Firewalls#mw-subcategories", "https://wiki.archlinux.org/index.php?title=Category:Networking&subcatfrom=Firewalls", true},
+		{"previous page", "/index.php?title=Category:Networking&pageuntil=Wireless#mw-pages", "", false},
+		{"not a category", "/index.php?title=Pacman&pagefrom=A", "", false},
+		{"member", "/title/Iptables", "", false},
+		{"other wiki", "https://example.com/index.php?title=Category:Networking&pagefrom=A", "", false},
+	}
+	m, err := compileCrawlScope(CrawlScope{Categories: []string{"Networking"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.listingContinuation(tt.href)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("listingContinuation(%q) = %q, %v, want %q, %v", tt.href, got, ok, tt.want, tt.wantOK)
+			}
+			if ok && !listingFilter.MatchString(got) {
+				t.Errorf("listingFilter does not match %q", got)
+			}
+		})
+	}
+
+	seeds, err := compileCrawlScope(CrawlScope{Seeds: []string{"Networking"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := seeds.listingContinuation(tests[0].href); ok {
+		t.Error("listingContinuation() followed a listing outside category mode")
+	}
+}
+
+func TestSeedURLs(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "seeds.txt")
+	if err := os.WriteFile(seedFile, []byte("# networking\nNetwork configuration\n\nhttps://wiki.archlinux.org/title/Iptables#Usage\nCafé\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := readSeedFile(seedFile)
+	if err != nil {
+		t.Fatalf("readSeedFile() error = %v", err)
+	}
+
+	scope := CrawlScope{Seeds: seeds, Categories: []string{"Security", "Category:Networking"}}
+	want := []string{
+		"https://wiki.archlinux.org/title/Network_configuration",
+		"https://wiki.archlinux.org/title/Iptables",
+		"https://wiki.archlinux.org/title/Caf%C3%A9",
+		"https://wiki.archlinux.org/title/Category:Security",
+		"https://wiki.archlinux.org/title/Category:Networking",
+	}
+	if got := scope.seedURLs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("seedURLs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// SkipRules decides which elements are left out of converted pages. An
+// element is skipped when it matches an Exclude selector and no Include
+// selector. Profile names a built-in set of exclusions that Exclude adds to.
+type SkipRules struct {
+	Profile string   `json:"profile"`
+	Exclude []string `json:"exclude"`
+	Include []string `json:"include"`
+}
+
+var skipProfiles = map[string][]string{
+	"archwiki": {
+		".mw-jump-link",
+		".mw-editsection",
+		".mw-editsection-bracket",
+		".vector-toc",
+		".mw-indicators",
+		".catlinks",
+		".printfooter",
+		".noprint",
+		".mw-empty-elt",
+		"#mw-navigation",
+		"#mw-head",
+		"#siteNotice",
+		"#archnavbar",
+		"#footer",
+		"#mw-page-tools",
+		"#mw-site-navigation",
+		"#toc",
+	},
+	"none": nil,
+}
+
+type skipMatcher struct {
+	exclude []cascadia.Selector
+	include []cascadia.Selector
+}
+
+var activeSkipRules = mustCompileSkipRules(SkipRules{Profile: "archwiki"})
+
+func loadSkipRules(filename string) (*skipMatcher, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules SkipRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse skip rules %s: %v", filename, err)
+	}
+	return compileSkipRules(rules)
+}
+
+func compileSkipRules(rules SkipRules) (*skipMatcher, error) {
+	profile := rules.Profile
+	if profile == "" {
+		profile = "archwiki"
+	}
+	base, ok := skipProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown skip profile %q", profile)
+	}
+
+	m := &skipMatcher{}
+	for _, sel := range append(append([]string(nil), base...), rules.Exclude...) {
+		compiled, err := cascadia.Compile(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude selector %q: %v", sel, err)
+		}
+		m.exclude = append(m.exclude, compiled)
+	}
+	for _, sel := range rules.Include {
+		compiled, err := cascadia.Compile(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include selector %q: %v", sel, err)
+		}
+		m.include = append(m.include, compiled)
+	}
+	return m, nil
+}
+
+func mustCompileSkipRules(rules SkipRules) *skipMatcher {
+	m, err := compileSkipRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m *skipMatcher) skip(s *goquery.Selection) bool {
+	excluded := false
+	for _, sel := range m.exclude {
+		if s.IsMatcher(sel) {
+			excluded = true
+			break
+		}
+	}
+	if !excluded {
+		return false
+	}
+	for _, sel := range m.include {
+		if s.IsMatcher(sel) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkipRules(t *testing.T) {
+	html := `
+		<p>Intro.</p>
+		<div class="noprint">Printable only on screen.</div>
+		<div class="navbox">Navigation box.</div>
+		<div id="toc">Contents</div>`
+
+	tests := []struct {
+		name    string
+		rules   SkipRules
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "default profile",
+			rules:   SkipRules{},
+			want:    []string{"Intro.", "Navigation box."},
+			notWant: []string{"Printable", "Contents"},
+		},
+		{
+			name:    "exclude adds to profile",
+			rules:   SkipRules{Exclude: []string{"div.navbox"}},
+			want:    []string{"Intro."},
+			notWant: []string{"Printable", "Navigation box.", "Contents"},
+		},
+		{
+			name:    "include overrides exclude",
+			rules:   SkipRules{Include: []string{".noprint"}},
+			want:    []string{"Printable only on screen.", "Navigation box."},
+			notWant: []string{"Contents"},
+		},
+		{
+			name:  "empty profile",
+			rules: SkipRules{Profile: "none"},
+			want:  []string{"Printable only on screen.", "Navigation box.", "Contents"},
+		},
+	}
+
+	defer func(rules *skipMatcher) { activeSkipRules = rules }(activeSkipRules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileSkipRules(tt.rules)
+			if err != nil {
+				t.Fatalf("compileSkipRules() error = %v", err)
+			}
+			activeSkipRules = rules
+
+			got := RenderMarkdown(parseTestDocument(t, html))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q in output:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("unexpected %q in output:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSkipRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	if _, err := loadSkipRules(write("valid.json", `{"exclude": ["table.navbox"], "include": ["#keep"]}`)); err != nil {
+		t.Errorf("loadSkipRules(valid) error = %v", err)
+	}
+
+	invalid := map[string]string{
+		"selector.json": `{"exclude": ["div["]}`,
+		"profile.json":  `{"profile": "wikipedia"}`,
+		"syntax.json":   `{"exclude": `,
+	}
+	for name, content := range invalid {
+		if _, err := loadSkipRules(write(name, content)); err == nil {
+			t.Errorf("loadSkipRules(%s) expected error", name)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE pages (
+	id            INTEGER PRIMARY KEY,
+	url           TEXT NOT NULL UNIQUE,
+	title         TEXT NOT NULL,
+	file          TEXT NOT NULL,
+	depth         INTEGER NOT NULL,
+	status        INTEGER NOT NULL,
+	parent_url    TEXT,
+	fetched_at    TEXT,
+	revision_id   INTEGER,
+	last_modified TEXT,
+	language      TEXT,
+	word_count    INTEGER,
+	importance    REAL,
+	content_hash  TEXT,
+	content       TEXT NOT NULL
+);
+
+CREATE TABLE sections (
+	page_id  INTEGER NOT NULL REFERENCES pages(id),
+	position INTEGER NOT NULL,
+	level    INTEGER NOT NULL,
+	title    TEXT NOT NULL,
+	anchor   TEXT,
+	offset   INTEGER NOT NULL,
+	content  TEXT NOT NULL,
+	PRIMARY KEY (page_id, position)
+);
+
+CREATE TABLE links (
+	page_id INTEGER NOT NULL REFERENCES pages(id),
+	kind    TEXT NOT NULL,
+	url     TEXT NOT NULL,
+	text    TEXT,
+	target  TEXT
+);
+CREATE INDEX links_url ON links(url);
+
+CREATE TABLE categories (
+	page_id INTEGER NOT NULL REFERENCES pages(id),
+	name    TEXT NOT NULL,
+	PRIMARY KEY (page_id, name)
+);
+CREATE INDEX categories_name ON categories(name);
+
+CREATE TABLE uncrawled_links (
+	url        TEXT PRIMARY KEY,
+	reasons    TEXT,
+	source_url TEXT
+);
+
+CREATE VIRTUAL TABLE pages_fts USING fts5(title, content, content='pages', content_rowid='id');
+`
+
+func runSQLite(args []string) error {
+	flags := flag.NewFlagSet("sqlite", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s sqlite [flags] [output_dir]\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flags.Output(), "Exports a finished crawl to a SQLite database with a full-text index (pages_fts).")
+		flags.PrintDefaults()
+	}
+	database := flags.String("o", "archwiki.db", "database file to create, replacing any existing one")
+	flags.Parse(args)
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one output directory, got %d", flags.NArg())
+	}
+	dir := "output"
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+	return exportSQLite(dir, *database)
+}
+
+// exportSQLite writes every page listed in the crawl manifest to a new
+// database. Sections, links and categories are only available for markdown
+// pages, which carry them in their front matter.
+func exportSQLite(dir, database string) error {
+	records, err := readManifest(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %v", err)
+	}
+	if err := os.Remove(database); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create schema: %v", err)
+	}
+	for _, record := range records {
+		if err := insertPage(tx, dir, record); err != nil {
+			return fmt.Errorf("failed to export %s: %v", record.File, err)
+		}
+	}
+	if err := insertUncrawledLinks(tx, filepath.Join(dir, validate.UncrawledFile)); err != nil {
+		return fmt.Errorf("failed to export uncrawled links: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO pages_fts(pages_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("failed to build full-text index: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+func insertPage(tx *sql.Tx, dir string, record PageRecord) error {
+	data, err := os.ReadFile(filepath.Join(dir, record.File))
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	meta := PageMeta{Title: record.Title, ContentHash: contentHash(content)}
+	switch filepath.Ext(record.File) {
+	case ".md":
+		if meta, content, err = parseFrontMatter(content); err != nil {
+			return err
+		}
+	case ".json":
+		// JSON pages are indexed by their section text, like markdown pages
+		// by their body, rather than as the JSON document.
+		var page jsonPage
+		if err := json.Unmarshal(data, &page); err != nil {
+			return err
+		}
+		meta = page.pageMeta()
+		content, meta.Sections = page.pageText()
+	}
+
+	result, err := tx.Exec(`INSERT INTO pages (url, title, file, depth, status, parent_url, fetched_at,
+		revision_id, last_modified, language, word_count, importance, content_hash, content)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.URL, record.Title, record.File, record.Depth, record.Status, nullString(record.ParentURL), nullTime(record.FetchedAt),
+		nullInt(meta.RevisionID), nullTime(meta.LastModified), nullString(meta.Language), meta.WordCount,
+		meta.Importance, meta.ContentHash, content)
+	if err != nil {
+		return err
+	}
+	pageID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	runes := []rune(content)
+	for i, section := range meta.Sections {
+		end := len(runes)
+		if i+1 < len(meta.Sections) {
+			end = meta.Sections[i+1].Offset
+		}
+		if section.Offset > end || end > len(runes) {
+			return fmt.Errorf("section %q is outside the page body", section.Title)
+		}
+		if _, err := tx.Exec(`INSERT INTO sections (page_id, position, level, title, anchor, offset, content) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			pageID, i, section.Level, section.Title, nullString(section.Anchor), section.Offset, string(runes[section.Offset:end])); err != nil {
+			return err
+		}
+	}
+	for _, link := range meta.Links {
+		if _, err := tx.Exec(`INSERT INTO links (page_id, kind, url, text, target) VALUES (?, ?, ?, ?, ?)`,
+			pageID, string(link.Kind), link.URL, link.Text, nullString(link.Target)); err != nil {
+			return err
+		}
+	}
+	for _, category := range meta.Categories {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO categories (page_id, name) VALUES (?, ?)`, pageID, category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertUncrawledLinks(tx *sql.Tx, filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if fields[0] == "" {
+			continue
+		}
+		fields = append(fields, "", "")
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO uncrawled_links (url, reasons, source_url) VALUES (?, ?, ?)`,
+			fields[0], fields[1], nullString(fields[2])); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
+
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.UTC().Format(time.RFC3339), Valid: true}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+func TestExportSQLite(t *testing.T) {
+	dir := t.TempDir()
+	body := "Intro\n\n## Installation\n\nInstall the package with pacman.\n\n## Usage\n\nRun it.\n"
+	meta := PageMeta{
+		Title:       "Pacman",
+		URL:         baseURL + "/title/Pacman",
+		Categories:  []string{"Package manager"},
+		ContentHash: contentHash(body),
+		Sections:    locateSections([]SectionEntry{{Level: 2, Title: "Installation"}, {Level: 2, Title: "Usage"}}, body),
+		Links: []OutboundLink{
+			{Kind: LinkWiki, URL: baseURL + "/title/Systemd", Text: "systemd", Target: "Systemd"},
+			{Kind: LinkExternal, URL: "https://archlinux.org/", Text: "Arch Linux"},
+		},
+	}
+	frontMatter, err := renderFrontMatter(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := json.Marshal(PageRecord{URL: meta.URL, File: "Pacman.md", Title: "Pacman", Status: 200})
+	files := map[string]string{
+		"Pacman.md":            frontMatter + "\n" + body,
+		"Unlisted.md":          "not in the manifest",
+		validate.ManifestFile:  string(record) + "\n",
+		validate.UncrawledFile: baseURL + "/title/Systemd\tdepth,max_files\t" + meta.URL + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	database := filepath.Join(t.TempDir(), "archwiki.db")
+	if err := exportSQLite(dir, database); err != nil {
+		t.Fatalf("exportSQLite() error = %v", err)
+	}
+
+	db, err := sql.Open("sqlite", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT count(*) FROM pages`, "1"},
+		{`SELECT content FROM pages`, body},
+		{`SELECT content FROM sections WHERE title = 'Installation'`, "## Installation\n\nInstall the package with pacman.\n\n"},
+		{`SELECT group_concat(kind, ',') FROM (SELECT kind FROM links ORDER BY kind)`, "external,wiki"},
+		{`SELECT name FROM categories`, "Package manager"},
+		{`SELECT reasons || ' ' || source_url FROM uncrawled_links WHERE url = '` + baseURL + `/title/Systemd'`, "depth,max_files " + meta.URL},
+		{`SELECT p.title FROM pages_fts JOIN pages p ON p.id = pages_fts.rowid WHERE pages_fts MATCH 'install*'`, "Pacman"},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := db.QueryRow(tt.query).Scan(&got); err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestExportSQLiteJSON(t *testing.T) {
+	dir := t.TempDir()
+	doc := parseTestDocument(t, `<p>Intro.</p><h2 id="Installation">Installation</h2><p>Install it with <a href="/title/Pacman">pacman</a>.</p>`)
+	meta := PageMeta{Title: "Yay", URL: baseURL + "/title/Yay", Categories: []string{"AUR helpers"}, RevisionID: 42}
+	data, err := renderPage("json", doc, filepath.Join(dir, "Yay.json"), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := json.Marshal(PageRecord{URL: meta.URL, File: "Yay.json", Title: "Yay", Status: 200})
+	files := map[string]string{
+		"Yay.json":            string(data),
+		validate.ManifestFile: string(record) + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	database := filepath.Join(t.TempDir(), "archwiki.db")
+	if err := exportSQLite(dir, database); err != nil {
+		t.Fatalf("exportSQLite() error = %v", err)
+	}
+	db, err := sql.Open("sqlite", database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT content FROM pages`, "Intro.\n\n## Installation\n\nInstall it with pacman.\n"},
+		{`SELECT revision_id FROM pages`, "42"},
+		{`SELECT content FROM sections WHERE title = 'Installation'`, "## Installation\n\nInstall it with pacman.\n"},
+		{`SELECT kind || ' ' || url FROM links`, "wiki " + baseURL + "/title/Pacman"},
+		{`SELECT name FROM categories`, "AUR helpers"},
+		{`SELECT count(*) FROM pages_fts WHERE pages_fts MATCH 'metadata OR date_scraped'`, "0"},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := db.QueryRow(tt.query).Scan(&got); err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
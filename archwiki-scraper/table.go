@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func parseTable(s *goquery.Selection) Block {
+	if !s.Is("table") {
+		return nil
+	}
+
+	if s.Find("table").Length() > 0 {
+		return rawHTML(s)
+	}
+
+	table := buildTable(s)
+	if len(table.Rows) == 0 {
+		return nil
+	}
+
+	if table.HeaderRows == 0 && tableHasBlockContent(table) {
+		return rawHTML(s)
+	}
+	return table
+}
+
+// rawHTML keeps a table too complex for the document model as HTML, without
+// the elements the skip rules leave out of pages. Renderers sanitise it.
+func rawHTML(s *goquery.Selection) Block {
+	table := s.Clone()
+	table.Find("*").Each(func(_ int, el *goquery.Selection) {
+		if el.Is("script, style") || shouldSkipElement(el) {
+			el.Remove()
+		}
+	})
+	html, err := goquery.OuterHtml(table)
+	if err != nil {
+		return nil
+	}
+	return RawHTML{HTML: strings.TrimSpace(html)}
+}
+
+func buildTable(s *goquery.Selection) Table {
+	var trs []*goquery.Selection
+	s.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+		if tr.Closest("table").Get(0) == s.Get(0) {
+			trs = append(trs, tr)
+		}
+	})
+
+	var table Table
+	table.Rows = make([][]*TableCell, len(trs))
+	headerRowsDone := false
+	headRows := 0
+	for r, tr := range trs {
+		col := 0
+		allHeaders := true
+		tr.ChildrenFiltered("th, td").Each(func(_ int, td *goquery.Selection) {
+			for col < len(table.Rows[r]) && table.Rows[r][col] != nil {
+				col++
+			}
+
+			colspan := spanAttr(td, "colspan")
+			rowspan := spanAttr(td, "rowspan")
+			if rowspan == 0 || r+rowspan > len(trs) {
+				rowspan = len(trs) - r
+			}
+			if colspan == 0 {
+				colspan = 1
+			}
+
+			cell := &TableCell{Header: td.Is("th"), Blocks: parseFlow(td)}
+			if !cell.Header {
+				allHeaders = false
+			}
+			for i := r; i < r+rowspan; i++ {
+				for j := col; j < col+colspan; j++ {
+					for len(table.Rows[i]) <= j {
+						table.Rows[i] = append(table.Rows[i], nil)
+					}
+					table.Rows[i][j] = cell
+				}
+			}
+			col += colspan
+		})
+
+		inHead := tr.ParentsFiltered("thead").Length() > 0
+		if !headerRowsDone && len(table.Rows[r]) > 0 && (inHead || allHeaders) {
+			table.HeaderRows++
+			if inHead {
+				headRows++
+			}
+		} else {
+			headerRowsDone = true
+		}
+	}
+
+	width := 0
+	for _, row := range table.Rows {
+		width = max(width, len(row))
+	}
+	filled := table.Rows[:0]
+	for i, row := range table.Rows {
+		if len(row) == 0 {
+			if i < table.HeaderRows {
+				table.HeaderRows--
+			}
+			continue
+		}
+		for len(row) < width {
+			row = append(row, nil)
+		}
+		filled = append(filled, row)
+	}
+	table.Rows = filled
+
+	if table.HeaderRows == len(table.Rows) {
+		table.HeaderRows = headRows
+	}
+	return table
+}
+
+func spanAttr(s *goquery.Selection, name string) int {
+	value, exists := s.Attr(name)
+	if !exists {
+		return 1
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 1
+	}
+	return min(n, 1000)
+}
+
+// tableHasBlockContent reports whether any data cell holds content that cannot
+// be written on a single GFM table line, such as lists or code blocks.
+func tableHasBlockContent(table Table) bool {
+	for _, row := range table.Rows[table.HeaderRows:] {
+		for _, cell := range row {
+			if cell == nil || cell.Header {
+				continue
+			}
+			for _, block := range cell.Blocks {
+				switch block.(type) {
+				case List, CodeBlock, DefinitionList, Table, RawHTML:
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
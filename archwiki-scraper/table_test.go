@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestProcessTable(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "header row with inline content",
+			html: `<table>
+				<tr><th>Name</th><th>Description</th></tr>
+				<tr><td><a href="/title/Btrfs">Btrfs</a></td><td>Uses <code>mkfs.btrfs</code> and <i>CoW</i></td></tr>
+			</table>`,
+			want: "| Name | Description |\n| --- | --- |\n| [Btrfs](/title/Btrfs) | Uses `mkfs.btrfs` and _CoW_ |",
+		},
+		{
+			name: "no header row",
+			html: `<table><tr><td>a</td><td>b</td></tr></table>`,
+			want: "|  |  |\n| --- | --- |\n| a | b |",
+		},
+		{
+			name: "header row only",
+			html: `<table><thead><tr><th>Option</th><th>Default</th></tr></thead></table>`,
+			want: "| Option | Default |\n| --- | --- |",
+		},
+		{
+			name: "row headers in body",
+			html: `<table>
+				<tr><th>Key</th><th>Value</th></tr>
+				<tr><th>Kernel</th><td>linux</td></tr>
+			</table>`,
+			want: "| Key | Value |\n| --- | --- |\n| **Kernel** | linux |",
+		},
+		{
+			name: "colspan and rowspan expanded",
+			html: `<table>
+				<tr><th rowspan="2">Name</th><th colspan="2">Support</th></tr>
+				<tr><th>Read</th><th>Write</th></tr>
+				<tr><td>ext4</td><td colspan="2">Yes</td></tr>
+				<tr><td rowspan="2">NTFS</td><td>Yes</td><td>Partial</td></tr>
+				<tr><td>No</td><td>No</td></tr>
+			</table>`,
+			want: "| Name | Support / Read | Support / Write |\n| --- | --- | --- |\n" +
+				"| ext4 | Yes | Yes |\n| NTFS | Yes | Partial |\n| NTFS | No | No |",
+		},
+		{
+			name: "pipes and line breaks escaped",
+			html: `<table><tr><th>Command</th></tr><tr><td><code>a | b</code><br>next</td></tr></table>`,
+			want: "| Command |\n| --- |\n| `a \\| b`<br>next |",
+		},
+		{
+			name: "ragged rows padded",
+			html: `<table><tr><th>A</th><th>B</th><th>C</th></tr><tr><td>1</td></tr></table>`,
+			want: "| A | B | C |\n| --- | --- | --- |\n| 1 |  |  |",
+		},
+		{
+			name: "block content falls back to key-value list",
+			html: `<table>
+				<tr><th>Manager</th><th>Packages</th></tr>
+				<tr><td>GDM</td><td><ul><li>gdm</li><li>gnome-shell</li></ul></td></tr>
+			</table>`,
+			want: "* **GDM**\n  * **Packages**:\n    * gdm\n    * gnome-shell",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got := renderBlock(parseTable(doc.Find("table").First()))
+			if got != tt.want {
+				t.Errorf("renderBlock(parseTable()) =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessTableNestedFallsBackToHTML(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<table><tr><td><table><tr><td>inner</td></tr></table></td></tr></table>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	got := renderBlock(parseTable(doc.Find("table").First()))
+	if !strings.HasPrefix(got, "<table>") || !strings.Contains(got, "inner") {
+		t.Errorf("renderBlock(parseTable()) = %q, want raw HTML table", got)
+	}
+}
+
+func TestProcessTableRawHTMLSanitized(t *testing.T) {
+	resetRedirects(t)
+	outputDir = "output"
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<table class="wikitable"><tr><td>
+		<table><tr><td class="x"><a href="/title/GNU#Tools">GNU</a><span class="noprint"> [edit]</span><script>alert(1)</script></td></tr></table>
+	</td></tr></table>`))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	got := convertWikiLinks(renderBlock(parseTable(doc.Find("table").First())))
+	want := `<table><tbody><tr><td>
+		<table><tbody><tr><td><a href="GNU.md#Tools">GNU</a></td></tr></tbody></table>
+	</td></tr></tbody></table>`
+	if got != want {
+		t.Errorf("raw HTML table = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SectionEntry describes a heading in a saved markdown page. Offset counts
+// characters from the start of the page body, after the front matter, to the
+// heading line.
+type SectionEntry struct {
+	Level  int    `json:"level" yaml:"level"`
+	Title  string `json:"title" yaml:"title"`
+	Anchor string `json:"anchor,omitempty" yaml:"anchor,omitempty"`
+	Offset int    `json:"offset" yaml:"offset"`
+}
+
+// sectionIndex locates each of the document's headings in its rendered
+// markdown.
+func sectionIndex(doc *Document, content string) []SectionEntry {
+	var entries []SectionEntry
+	doc.WalkSections(func(_ []string, s *Section) {
+		entries = append(entries, SectionEntry{Level: s.Level, Title: s.Title, Anchor: s.Anchor})
+	})
+	return locateSections(entries, content)
+}
+
+// locateSections sets the offset of each entry's heading in content, dropping
+// headings that cannot be found. Headings are searched for in order, so a
+// heading is never matched before the one preceding it.
+func locateSections(entries []SectionEntry, content string) []SectionEntry {
+	var located []SectionEntry
+	pos := 0
+	for _, entry := range entries {
+		heading := strings.Repeat("#", entry.Level) + " " + entry.Title
+		idx := headingLineIndex(content[pos:], heading)
+		if idx < 0 {
+			continue
+		}
+		idx += pos
+		entry.Offset = utf8.RuneCountInString(content[:idx])
+		located = append(located, entry)
+		pos = idx + len(heading)
+	}
+	return located
+}
+
+func headingLineIndex(content, heading string) int {
+	for start := 0; ; {
+		i := strings.Index(content[start:], heading)
+		if i < 0 {
+			return -1
+		}
+		i += start
+		end := i + len(heading)
+		if (i == 0 || content[i-1] == '\n') && (end == len(content) || content[end] == '\n') {
+			return i
+		}
+		start = i + 1
+	}
+}
+
+// renderTOC renders a nested list linking to every section of the document.
+func renderTOC(doc *Document) string {
+	var lines []string
+	doc.WalkSections(func(path []string, s *Section) {
+		entry := s.Title
+		if s.Anchor != "" {
+			entry = "[" + s.Title + "](#" + s.Anchor + ")"
+		}
+		lines = append(lines, strings.Repeat("  ", len(path)-1)+"* "+entry)
+	})
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const tocTestHTML = `
+	<p>Intro with ## Usage inline.</p>
+	<h2 id="Usage">Usage</h2>
+	<pre>## Usage</pre>
+	<h3 id="Café">Café</h3>
+	<p>Text.</p>
+	<h3>Untitled anchor</h3>
+	<h2 id="Usage_2">Usage</h2>`
+
+func TestSectionIndex(t *testing.T) {
+	doc := parseTestDocument(t, tocTestHTML)
+	content := RenderMarkdown(doc)
+
+	got := sectionIndex(doc, content)
+	want := []SectionEntry{
+		{Level: 2, Title: "Usage", Anchor: "Usage"},
+		{Level: 3, Title: "Café", Anchor: "Café"},
+		{Level: 3, Title: "Untitled anchor"},
+		{Level: 2, Title: "Usage", Anchor: "Usage_2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sectionIndex() returned %d entries, want %d: %+v", len(got), len(want), got)
+	}
+
+	runes := []rune(content)
+	for i := range got {
+		heading := strings.Repeat("#", want[i].Level) + " " + want[i].Title
+		if offset := got[i].Offset; offset > len(runes) || !strings.HasPrefix(string(runes[offset:]), heading) {
+			t.Errorf("entry %d offset %d does not point at %q", i, offset, heading)
+		}
+		want[i].Offset = got[i].Offset
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sectionIndex() = %+v, want %+v", got, want)
+	}
+	if got[0].Offset > got[1].Offset || got[2].Offset > got[3].Offset {
+		t.Errorf("offsets out of order: %+v", got)
+	}
+	if first := strings.Index(content, "<a id=\"Usage\"></a>"); got[0].Offset < utf8.RuneCountInString(content[:first]) {
+		t.Errorf("first heading matched before its anchor: %+v", got[0])
+	}
+}
+
+func TestRenderTOC(t *testing.T) {
+	got := renderTOC(parseTestDocument(t, tocTestHTML))
+	want := "* [Usage](#Usage)\n  * [Café](#Café)\n  * Untitled anchor\n* [Usage](#Usage_2)"
+	if got != want {
+		t.Errorf("renderTOC() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderPageSections(t *testing.T) {
+	defer func(toc bool) { *tableOfContents = toc }(*tableOfContents)
+	*tableOfContents = true
+
+	doc := parseTestDocument(t, `<p>Intro.</p><h2 id="Usage">Usage</h2><p>Text.</p>`)
+	page, err := renderPage("markdown", doc, "output/Test.md", PageMeta{Title: "Test", DateScraped: time.Now()})
+	if err != nil {
+		t.Fatalf("renderPage() error = %v", err)
+	}
+
+	got := string(page)
+	body := got[strings.Index(got, "\n---\n\n")+len("\n---\n\n"):]
+	if !strings.HasPrefix(body, "* [Usage](#Usage)\n\nIntro.") {
+		t.Errorf("expected table of contents at the top of the body:\n%s", body)
+	}
+	offset := strings.Index(body, "## Usage")
+	if want := "sections:\n  - level: 2\n    title: Usage\n    anchor: Usage\n    offset: " + strconv.Itoa(offset) + "\n"; !strings.Contains(got, want) {
+		t.Errorf("expected %q in front matter:\n%s", want, got)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+// Reasons a discovered link was not fetched.
+const (
+	skipDepth     = "depth"     // beyond the maximum crawl depth
+	skipMaxFiles  = "max_files" // the max-files limit was reached first
+	skipFiltered  = "filtered"  // excluded by the crawl scope
+	skipNamespace = "namespace" // in a namespace that is never crawled, such as Talk
+	skipLanguage  = "language"  // a translation rather than an English page
+	skipError     = "error"     // the request failed
+)
+
+type uncrawledLink struct {
+	source  string
+	reasons []string
+}
+
+var (
+	uncrawledLinks = make(map[string]*uncrawledLink)
+	fetchedURLs    = make(map[string]bool)
+	uncrawledMutex sync.Mutex
+)
+
+// recordUncrawled notes that linkURL, found on source, was not fetched.
+// source is only kept for the first sighting.
+func recordUncrawled(linkURL, source, reason string) {
+	uncrawledMutex.Lock()
+	defer uncrawledMutex.Unlock()
+	link, ok := uncrawledLinks[linkURL]
+	if !ok {
+		link = &uncrawledLink{source: source}
+		uncrawledLinks[linkURL] = link
+	}
+	if !slices.Contains(link.reasons, reason) {
+		link.reasons = append(link.reasons, reason)
+	}
+}
+
+// markFetched records that a page was retrieved, so that links to it are left
+// out of the uncrawled report even if they were skipped elsewhere.
+func markFetched(pageURL string) {
+	uncrawledMutex.Lock()
+	defer uncrawledMutex.Unlock()
+	fetchedURLs[pageURL] = true
+}
+
+// writeUncrawledLinks writes one line per link that was never fetched, sorted
+// by URL: the URL, its reasons separated by commas and the page it was first
+// found on, separated by tabs.
+func writeUncrawledLinks(dir string) error {
+	uncrawledMutex.Lock()
+	defer uncrawledMutex.Unlock()
+
+	var urls []string
+	for linkURL := range uncrawledLinks {
+		if !fetchedURLs[linkURL] {
+			urls = append(urls, linkURL)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	sort.Strings(urls)
+
+	f, err := os.Create(filepath.Join(dir, validate.UncrawledFile))
+	if err != nil {
+		return fmt.Errorf("failed to create uncrawled links file: %v", err)
+	}
+	defer f.Close()
+
+	for _, linkURL := range urls {
+		link := uncrawledLinks[linkURL]
+		reasons := slices.Sorted(slices.Values(link.reasons))
+		if _, err := fmt.Fprintf(f, "%s\t%s\t%s\n", linkURL, strings.Join(reasons, ","), link.source); err != nil {
+			return fmt.Errorf("failed to write uncrawled link: %v", err)
+		}
+	}
+	return f.Close()
+}
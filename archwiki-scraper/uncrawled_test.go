@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyeb/archwiki-scraper/validate"
+)
+
+func TestWriteUncrawledLinks(t *testing.T) {
+	defer func(links map[string]*uncrawledLink, fetched map[string]bool) {
+		uncrawledLinks, fetchedURLs = links, fetched
+	}(uncrawledLinks, fetchedURLs)
+	uncrawledLinks = make(map[string]*uncrawledLink)
+	fetchedURLs = make(map[string]bool)
+
+	recordUncrawled(baseURL+"/title/Xorg", baseURL+"/title/Arch_Linux", skipMaxFiles)
+	recordUncrawled(baseURL+"/title/Xorg", baseURL+"/title/Pacman", skipFiltered)
+	recordUncrawled(baseURL+"/title/Xorg", baseURL+"/title/Pacman", skipMaxFiles)
+	recordUncrawled(baseURL+"/title/Talk:Pacman", baseURL+"/title/Pacman", skipNamespace)
+	recordUncrawled(baseURL+"/title/Systemd", baseURL+"/title/Arch_Linux", skipFiltered)
+	markFetched(baseURL + "/title/Systemd")
+
+	dir := t.TempDir()
+	if err := writeUncrawledLinks(dir); err != nil {
+		t.Fatalf("writeUncrawledLinks() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, validate.UncrawledFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := baseURL + "/title/Talk:Pacman\tnamespace\t" + baseURL + "/title/Pacman\n" +
+		baseURL + "/title/Xorg\tfiltered,max_files\t" + baseURL + "/title/Arch_Linux\n"
+	if string(data) != want {
+		t.Errorf("uncrawled links =\n%s\nwant\n%s", data, want)
+	}
+}
@@ -2,14 +2,27 @@ package validate
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"html"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/kyeb/archwiki-scraper/wikipath"
 )
 
+// ManifestFile is the crawl manifest listing every saved page, one JSON
+// record per line.
+const ManifestFile = "manifest.jsonl"
+
+// UncrawledFile lists links the crawler found but never fetched, one per
+// line: the URL, the comma-separated reasons and the page it was first found
+// on, separated by tabs.
+const UncrawledFile = "uncrawled_links.txt"
+
 // ValidateLinks checks all markdown files in the given directory for broken links
 // Returns a list of error messages, or an empty list if all links are valid
 func ValidateLinks(outputDir string) []string {
@@ -17,7 +30,8 @@ func ValidateLinks(outputDir string) []string {
 
 	// Load uncrawled links if they exist
 	uncrawledLinks := make(map[string]bool)
-	uncrawledFile := filepath.Join(outputDir, "uncrawled_links.txt")
+	uncrawledTitles := make(map[string]bool)
+	uncrawledFile := filepath.Join(outputDir, UncrawledFile)
 	if _, err := os.Stat(uncrawledFile); err == nil {
 		file, err := os.Open(uncrawledFile)
 		if err == nil {
@@ -26,114 +40,139 @@ func ValidateLinks(outputDir string) []string {
 				parts := strings.Split(scanner.Text(), "\t")
 				if len(parts) > 0 {
 					uncrawledLinks[parts[0]] = true
+					if title := titleFromURL(parts[0]); title != "" {
+						uncrawledTitles[title] = true
+					}
 				}
 			}
 			file.Close()
 		}
 	}
 
+	// Map file names back to titles, preferring the crawler's record of the
+	// names it assigned
+	titleFiles, _ := wikipath.ReadFiles(filepath.Join(outputDir, wikipath.TitlesFile))
+	fileTitle := func(file string) string {
+		if title, ok := titleFiles[file]; ok {
+			return wikipath.Normalize(title)
+		}
+		title, err := wikipath.Decode(strings.TrimSuffix(file, ".md"))
+		if err != nil {
+			return ""
+		}
+		return wikipath.Normalize(title)
+	}
+
 	// Regular expression to match markdown links
 	linkRegex := regexp.MustCompile(`\[([^\]]+)\]\(([^\)]+)\)`)
 
-	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+	files, err := markdownFiles(outputDir)
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Error listing markdown files: %v", err))
+	}
+
+	for _, path := range files {
+		content, err := os.ReadFile(path)
 		if err != nil {
-			return err
+			errors = append(errors, fmt.Sprintf("Error reading file %s: %v", path, err))
+			continue
 		}
 
-		if !info.IsDir() && strings.HasSuffix(path, ".md") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error reading file %s: %v", path, err)
+		matches := linkRegex.FindAllStringSubmatch(string(content), -1)
+		for _, match := range matches {
+			if len(match) != 3 {
+				continue
 			}
 
-			matches := linkRegex.FindAllStringSubmatch(string(content), -1)
-			for _, match := range matches {
-				if len(match) != 3 {
-					continue
-				}
-
-				linkText := match[1]
-				linkTarget := match[2]
+			linkText := match[1]
+			linkTarget := match[2]
 
-				// Check if it's an absolute URL
-				if strings.HasPrefix(linkTarget, "http://") || strings.HasPrefix(linkTarget, "https://") {
-					_, err := url.Parse(linkTarget)
-					if err != nil {
-						errors = append(errors, fmt.Sprintf("Invalid URL in %s: [%s](%s)", path, linkText, linkTarget))
-					}
-					// Skip validation for uncrawled links
-					if uncrawledLinks[linkTarget] {
-						continue
-					}
+			// Check if it's an absolute URL
+			if strings.HasPrefix(linkTarget, "http://") || strings.HasPrefix(linkTarget, "https://") {
+				_, err := url.Parse(linkTarget)
+				if err != nil {
+					errors = append(errors, fmt.Sprintf("Invalid URL in %s: [%s](%s)", path, linkText, linkTarget))
+				}
+				// Skip validation for uncrawled links
+				if uncrawledLinks[linkTarget] {
 					continue
 				}
+				continue
+			}
 
-				// Handle relative links
-				if strings.Contains(linkTarget, "#") {
-					parts := strings.Split(linkTarget, "#")
-					linkTarget = parts[0]
-					anchor := parts[1]
-
-					// Check if the file exists
-					targetPath := filepath.Join(filepath.Dir(path), linkTarget)
-					if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-						// Convert relative path to absolute URL for checking against uncrawled links
-						relPath := strings.TrimSuffix(linkTarget, ".md")
-						if strings.HasPrefix(relPath, "../") {
-							// Handle relative paths that go up directories
-							parts := strings.Split(path, string(os.PathSeparator))
-							depth := strings.Count(relPath, "../")
-							if len(parts) > depth {
-								relPath = strings.TrimPrefix(relPath, strings.Repeat("../", depth))
-							}
-						}
-						absURL := "https://wiki.archlinux.org/title/" + relPath
-
-						if !uncrawledLinks[absURL] {
-							errors = append(errors, fmt.Sprintf("Broken relative link in %s: [%s](%s) -> %s", path, linkText, linkTarget, targetPath))
-						}
-					} else {
-						// Check if the anchor exists in the file
-						content, err := os.ReadFile(targetPath)
-						if err == nil && !headerExists(string(content), anchor) {
-							errors = append(errors, fmt.Sprintf("Broken anchor in %s: [%s](%s) -> %s", path, linkText, linkTarget, targetPath))
-						}
-					}
-				} else {
-					// Handle links without anchors
-					targetPath := filepath.Join(filepath.Dir(path), linkTarget)
-					if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-						// Convert relative path to absolute URL for checking against uncrawled links
-						relPath := strings.TrimSuffix(linkTarget, ".md")
-						if strings.HasPrefix(relPath, "../") {
-							// Handle relative paths that go up directories
-							parts := strings.Split(path, string(os.PathSeparator))
-							depth := strings.Count(relPath, "../")
-							if len(parts) > depth {
-								relPath = strings.TrimPrefix(relPath, strings.Repeat("../", depth))
-							}
-						}
-						absURL := "https://wiki.archlinux.org/title/" + relPath
-
-						if !uncrawledLinks[absURL] {
-							errors = append(errors, fmt.Sprintf("Broken relative link in %s: [%s](%s) -> %s", path, linkText, linkTarget, targetPath))
-						}
-					}
+			// Handle relative links
+			linkTarget, anchor, hasAnchor := strings.Cut(linkTarget, "#")
+			targetPath := filepath.Join(filepath.Dir(path), linkTarget)
+			if linkTarget == "" {
+				targetPath = path
+			}
+			if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+				// Links to pages the crawler chose not to fetch are expected to be missing
+				if title := fileTitle(filepath.Base(linkTarget)); title == "" || !uncrawledTitles[title] {
+					errors = append(errors, fmt.Sprintf("Broken relative link in %s: [%s](%s) -> %s", path, linkText, linkTarget, targetPath))
+				}
+			} else if hasAnchor {
+				// Check if the anchor exists in the file
+				content, err := os.ReadFile(targetPath)
+				if err == nil && !headerExists(string(content), anchor) {
+					errors = append(errors, fmt.Sprintf("Broken anchor in %s: [%s](%s) -> %s", path, linkText, linkTarget, targetPath))
 				}
 			}
 		}
+	}
+
+	return errors
+}
+
+// markdownFiles lists the pages recorded in the crawl manifest, or every
+// markdown file in the directory when there is no manifest.
+func markdownFiles(outputDir string) ([]string, error) {
+	var files []string
+
+	f, err := os.Open(filepath.Join(outputDir, ManifestFile))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			var record struct {
+				File string `json:"file"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return nil, fmt.Errorf("invalid manifest record: %v", err)
+			}
+			if strings.HasSuffix(record.File, ".md") {
+				files = append(files, filepath.Join(outputDir, record.File))
+			}
+		}
+		return files, scanner.Err()
+	}
+
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".md") {
+			files = append(files, path)
+		}
 		return nil
 	})
+	return files, err
+}
 
-	if err != nil {
-		errors = append(errors, fmt.Sprintf("Error walking directory: %v", err))
+func titleFromURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil || !strings.HasPrefix(u.Path, "/title/") {
+		return ""
 	}
-
-	return errors
+	return wikipath.Normalize(strings.TrimPrefix(u.Path, "/title/"))
 }
 
-// Function to check if a header exists in the file
+// Function to check if a header or explicit anchor exists in the file
 func headerExists(content string, anchor string) bool {
+	if strings.Contains(content, `<a id="`+html.EscapeString(anchor)+`"></a>`) {
+		return true
+	}
 	headerRegex := regexp.MustCompile(`(?m)^#+\s+` + regexp.QuoteMeta(anchor) + `$`)
 	return headerRegex.MatchString(content)
 }
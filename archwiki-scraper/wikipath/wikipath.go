@@ -0,0 +1,232 @@
+// Package wikipath maps wiki page titles to file names in the output
+// directory and back.
+//
+// Titles are normalised to their URL form, with underscores for spaces.
+// Letters, digits, '_', '-', '.' and ',' are kept; every other byte, and a
+// leading '.', is written as '~' followed by two upper-case hex digits. The
+// result is a single path component that is safe on common filesystems and
+// needs no escaping inside a markdown link. Names longer than MaxNameLength
+// are cut short and given a '~~' suffix with a hash of the title. Titles that
+// differ only in case would collide on case-insensitive filesystems, so a
+// Manifest gives them a '~~' suffix too and records the mapping.
+package wikipath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TitlesFile is the name of the title to file mapping written to the
+// output directory.
+const TitlesFile = "titles.json"
+
+// MaxNameLength is the longest name Encode returns. It leaves room for a
+// collision suffix and an extension within the 255 byte file name limit of
+// common filesystems.
+const MaxNameLength = 200
+
+// Normalize returns the URL form of a title.
+func Normalize(title string) string {
+	return strings.ReplaceAll(strings.TrimSpace(title), " ", "_")
+}
+
+// Encode returns the file name, without extension, for a title.
+func Encode(title string) string {
+	title = Normalize(title)
+	var b strings.Builder
+	suffix := hashSuffix(title)
+	cut := 0
+	for i := 0; i < len(title); {
+		r, size := utf8.DecodeRuneInString(title[i:])
+		if r == utf8.RuneError && size == 1 || !safeRune(r) || i == 0 && r == '.' {
+			for _, c := range []byte(title[i : i+size]) {
+				fmt.Fprintf(&b, "~%02X", c)
+			}
+		} else {
+			b.WriteString(title[i : i+size])
+		}
+		if b.Len() <= MaxNameLength-len(suffix) {
+			cut = b.Len()
+		}
+		i += size
+	}
+	if b.Len() > MaxNameLength {
+		return b.String()[:cut] + suffix
+	}
+	return b.String()
+}
+
+func hashSuffix(title string) string {
+	sum := sha256.Sum256([]byte(title))
+	return "~~" + hex.EncodeToString(sum[:4])
+}
+
+func safeRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' ||
+			r == '_' || r == '-' || r == '.' || r == ','
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Decode reverses Encode. Names carrying a collision suffix can only be
+// resolved through the Manifest that assigned them.
+func Decode(name string) (string, error) {
+	var buf []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] != '~' {
+			buf = append(buf, name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", fmt.Errorf("truncated escape in %q", name)
+		}
+		c, err := hex.DecodeString(name[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", name)
+		}
+		buf = append(buf, c[0])
+		i += 2
+	}
+	return string(buf), nil
+}
+
+// Entry is one line of the title to file mapping.
+type Entry struct {
+	Title string `json:"title"`
+	File  string `json:"file"`
+}
+
+// Manifest assigns file names to titles, making sure no two titles get names
+// that differ only in case.
+type Manifest struct {
+	mu      sync.RWMutex
+	names   map[string]string // map[title]name
+	folded  map[string]string // map[lower-case name]title
+	renamed int
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{names: make(map[string]string), folded: make(map[string]string)}
+}
+
+// Assign returns the file name for title, assigning one if the title has not
+// been seen before.
+func (m *Manifest) Assign(title string) string {
+	title = Normalize(title)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if name, ok := m.names[title]; ok {
+		return name
+	}
+	name := Encode(title)
+	if other, taken := m.folded[strings.ToLower(name)]; taken && other != title {
+		name += hashSuffix(title)
+		m.renamed++
+	}
+	m.names[title] = name
+	m.folded[strings.ToLower(name)] = title
+	return name
+}
+
+// Settle gives the '~~' suffix to every title whose name collides with
+// another's, including the title first assigned the name, so that names no
+// longer depend on the order titles were assigned in. It returns the names
+// that changed, keyed by their old name.
+func (m *Manifest) Settle() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	titles := make(map[string]int)
+	for title := range m.names {
+		titles[strings.ToLower(Encode(title))]++
+	}
+	renamed := make(map[string]string)
+	for title, name := range m.names {
+		if titles[strings.ToLower(Encode(title))] < 2 || name != Encode(title) {
+			continue
+		}
+		settled := name + hashSuffix(title)
+		renamed[name] = settled
+		m.names[title] = settled
+		m.folded[strings.ToLower(settled)] = title
+		m.renamed++
+	}
+	return renamed
+}
+
+// Name returns the file name assigned to title, or the name it would get if
+// it were assigned now without colliding.
+func (m *Manifest) Name(title string) string {
+	title = Normalize(title)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if name, ok := m.names[title]; ok {
+		return name
+	}
+	return Encode(title)
+}
+
+// Renamed returns the titles whose assigned name differs from Encode.
+func (m *Manifest) Renamed() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.renamed == 0 {
+		return nil
+	}
+	var titles []string
+	for title, name := range m.names {
+		if name != Encode(title) {
+			titles = append(titles, title)
+		}
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+// Entries lists every assigned title, sorted by title, with file names
+// carrying ext.
+func (m *Manifest) Entries(ext string) []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]Entry, 0, len(m.names))
+	for title, name := range m.names {
+		entries = append(entries, Entry{Title: strings.ReplaceAll(title, "_", " "), File: name + ext})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Title < entries[j].Title })
+	return entries
+}
+
+func (m *Manifest) WriteFile(filename, ext string) error {
+	data, err := json.MarshalIndent(m.Entries(ext), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// ReadFiles loads a mapping written by WriteFile, keyed by file name.
+func ReadFiles(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		files[entry.File] = entry.Title
+	}
+	return files, nil
+}
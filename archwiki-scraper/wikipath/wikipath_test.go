@@ -0,0 +1,141 @@
+package wikipath
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Arch Linux", "Arch_Linux"},
+		{"Arch_Linux", "Arch_Linux"},
+		{"DeveloperWiki:Project Leader", "DeveloperWiki~3AProject_Leader"},
+		{"Pacman/Tips and tricks", "Pacman~2FTips_and_tricks"},
+		{"../../etc/passwd", "~2E.~2F..~2Fetc~2Fpasswd"},
+		{".bashrc", "~2Ebashrc"},
+		{"Café", "Café"},
+		{"C++ (language)", "C~2B~2B_~28language~29"},
+		{"100%", "100~25"},
+		{"a~b", "a~7Eb"},
+		{"Arch Linux (简体中文)", "Arch_Linux_~28简体中文~29"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got := Encode(tt.title)
+			if got != tt.want {
+				t.Errorf("Encode(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+			if filepath.Base(got) != got || strings.HasPrefix(got, ".") {
+				t.Errorf("Encode(%q) = %q is not a safe file name", tt.title, got)
+			}
+			decoded, err := Decode(got)
+			if err != nil {
+				t.Fatalf("Decode(%q) error = %v", got, err)
+			}
+			if decoded != Normalize(tt.title) {
+				t.Errorf("Decode(%q) = %q, want %q", got, decoded, Normalize(tt.title))
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, name := range []string{"a~", "a~2", "a~zz", "Foo~~1a2b3c4d"} {
+		if _, err := Decode(name); err == nil {
+			t.Errorf("Decode(%q) expected error", name)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	m := NewManifest()
+
+	first := m.Assign("Pkgbuild")
+	if first != "Pkgbuild" {
+		t.Errorf("Assign(Pkgbuild) = %q", first)
+	}
+	if again := m.Assign("Pkgbuild"); again != first {
+		t.Errorf("Assign is not stable: %q then %q", first, again)
+	}
+	if name := m.Name("PKGBUILD"); name != "PKGBUILD" {
+		t.Errorf("Name(PKGBUILD) before assignment = %q", name)
+	}
+
+	second := m.Assign("PKGBUILD")
+	if strings.EqualFold(first, second) {
+		t.Errorf("case-only collision: %q and %q", first, second)
+	}
+	if name := m.Name("PKGBUILD"); name != second {
+		t.Errorf("Name(PKGBUILD) = %q, want %q", name, second)
+	}
+	if renamed := m.Renamed(); !reflect.DeepEqual(renamed, []string{"PKGBUILD"}) {
+		t.Errorf("Renamed() = %v", renamed)
+	}
+
+	filename := filepath.Join(t.TempDir(), TitlesFile)
+	if err := m.WriteFile(filename, ".md"); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	files, err := ReadFiles(filename)
+	if err != nil {
+		t.Fatalf("ReadFiles() error = %v", err)
+	}
+	want := map[string]string{"Pkgbuild.md": "Pkgbuild", second + ".md": "PKGBUILD"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("ReadFiles() = %v, want %v", files, want)
+	}
+}
+
+func TestEncodeLongTitle(t *testing.T) {
+	long := strings.Repeat("Ж", 150)
+	name := Encode(long)
+	if len(name) > MaxNameLength {
+		t.Errorf("len(Encode(long title)) = %d, want at most %d", len(name), MaxNameLength)
+	}
+	if !strings.HasPrefix(name, strings.Repeat("Ж", 10)) || !strings.Contains(name, "~~") {
+		t.Errorf("Encode(long title) = %q, want a truncated name with a hash suffix", name)
+	}
+	if other := Encode(long + "!"); other == name {
+		t.Errorf("Encode gives %q for two long titles with the same prefix", name)
+	}
+	plus := strings.Repeat("+", 100)
+	if prefix, ok := strings.CutSuffix(Encode(plus), hashSuffix(plus)); !ok || len(prefix)%3 != 0 {
+		t.Errorf("Encode(escaped long title) = %q, want whole escapes before the suffix", Encode(plus))
+	}
+}
+
+func TestManifestSettle(t *testing.T) {
+	orders := [][]string{{"Pkgbuild", "PKGBUILD", "Pacman"}, {"PKGBUILD", "Pacman", "Pkgbuild"}}
+	var names []map[string]string
+	for _, order := range orders {
+		m := NewManifest()
+		assigned := make(map[string]string)
+		for _, title := range order {
+			assigned[title] = m.Assign(title)
+		}
+		renamed := m.Settle()
+		if len(renamed) != 1 {
+			t.Errorf("Settle() = %v, want the first of the colliding titles renamed", renamed)
+		}
+		got := make(map[string]string)
+		for _, title := range order {
+			got[title] = m.Name(title)
+			if old := assigned[title]; old != got[title] && renamed[old] != got[title] {
+				t.Errorf("Settle() did not report %q renamed to %q", old, got[title])
+			}
+		}
+		names = append(names, got)
+	}
+	if !reflect.DeepEqual(names[0], names[1]) {
+		t.Errorf("names depend on assignment order: %v and %v", names[0], names[1])
+	}
+	if names[0]["Pacman"] != "Pacman" || names[0]["Pkgbuild"] == "Pkgbuild" {
+		t.Errorf("Settle() names = %v, want only the colliding titles suffixed", names[0])
+	}
+}